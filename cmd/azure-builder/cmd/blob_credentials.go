@@ -0,0 +1,147 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	"github.com/nukleros/azure-builder/pkg/blob"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	blobConfigPath               string
+	blobCredentialsKeyName       string
+	blobCredentialsSAS           bool
+	blobCredentialsContainer     string
+	blobCredentialsPermissions   string
+	blobCredentialsResourceTypes string
+	blobCredentialsExpiry        time.Duration
+	blobCredentialsOutputPath    string
+	blobCredentialsSecretName    string
+	blobCredentialsNamespace     string
+)
+
+// getBlobCredentialsCmd represents the get command for the credentials of a
+// blob storage account.
+var getBlobCredentialsCmd = &cobra.Command{
+	Use:   "blob-credentials",
+	Short: "Retrieve the keys, connection string and SAS for a blob storage account",
+	Long: `Retrieve the account key and connection string for a blob storage account and
+optionally sign an account or container SAS with the key. The credentials are written
+to stdout as JSON unless an output file is given, or rendered as a Kubernetes Secret
+manifest with --secret-name.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if blobCredentialsContainer != "" && !blobCredentialsSAS {
+			return fmt.Errorf("--container can only be used with --sas")
+		}
+
+		// Load credentials used to connect to Azure
+		session, err := loadAzureSession(azureCredentialsPath)
+		if err != nil {
+			return err
+		}
+
+		// Load blob config file used to create the storage account
+		_, blobConfig, err := loadBlobConfig(blobConfigPath)
+		if err != nil {
+			return err
+		}
+
+		var sasOptions *blob.SASOptions
+		if blobCredentialsSAS {
+			sasOptions = &blob.SASOptions{
+				Container:     blobCredentialsContainer,
+				Permissions:   blobCredentialsPermissions,
+				ResourceTypes: blobCredentialsResourceTypes,
+				Expiry:        time.Now().Add(blobCredentialsExpiry),
+			}
+		}
+
+		credentials, err := blob.GetStorageCredentials(context.Background(), blobConfig, session, blobCredentialsKeyName, sasOptions)
+		if err != nil {
+			return fmt.Errorf("could not get blob storage account credentials: %w", err)
+		}
+
+		var output []byte
+		if blobCredentialsSecretName != "" {
+			output, err = credentials.KubernetesSecretManifest(blobCredentialsSecretName, blobCredentialsNamespace)
+			if err != nil {
+				return err
+			}
+		} else {
+			output, err = json.MarshalIndent(credentials, "", "  ")
+			if err != nil {
+				return fmt.Errorf("could not JSON marshal blob storage account credentials: %w", err)
+			}
+			output = append(output, '\n')
+		}
+
+		if blobCredentialsOutputPath == "" {
+			fmt.Print(string(output))
+			return nil
+		}
+
+		if err = os.WriteFile(blobCredentialsOutputPath, output, 0600); err != nil {
+			return fmt.Errorf("could not write blob storage account credentials file: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getBlobCredentialsCmd)
+	getBlobCredentialsCmd.Flags().StringVarP(&blobConfigPath, "blob-config", "c", "",
+		"Location to blob config used to create the resource")
+	getBlobCredentialsCmd.Flags().StringVarP(&azureCredentialsPath, "creds-path", "p", "",
+		"Location to JSON file containing Azure credentials. To generate one, use the Azure CLI and refer to command 'az ad sp create-for-rbac'")
+	getBlobCredentialsCmd.Flags().StringVar(&blobCredentialsKeyName, "key", blob.AccountKeyPrimary,
+		fmt.Sprintf("Account key to use, one of %s or %s", blob.AccountKeyPrimary, blob.AccountKeySecondary))
+	getBlobCredentialsCmd.Flags().BoolVar(&blobCredentialsSAS, "sas", false,
+		"Sign a SAS token with the account key")
+	getBlobCredentialsCmd.Flags().StringVar(&blobCredentialsContainer, "container", "",
+		"Scope the SAS to this container instead of the whole account")
+	getBlobCredentialsCmd.Flags().StringVar(&blobCredentialsPermissions, "permissions", "rl",
+		"SAS permissions, e.g. r (read), a (add), c (create), w (write), d (delete), l (list)")
+	getBlobCredentialsCmd.Flags().StringVar(&blobCredentialsResourceTypes, "resource-types", "sco",
+		"Resource types of an account SAS: s (service), c (container), o (object)")
+	getBlobCredentialsCmd.Flags().DurationVar(&blobCredentialsExpiry, "expiry", 24*time.Hour,
+		"How long the SAS is valid for")
+	getBlobCredentialsCmd.Flags().StringVarP(&blobCredentialsOutputPath, "output", "o", "",
+		"Location to write the credentials to. Defaults to stdout")
+	getBlobCredentialsCmd.Flags().StringVar(&blobCredentialsSecretName, "secret-name", "",
+		"Render the credentials as a Kubernetes Secret manifest with this name")
+	getBlobCredentialsCmd.Flags().StringVar(&blobCredentialsNamespace, "namespace", "",
+		"Namespace of the Kubernetes Secret")
+
+	getBlobCredentialsCmd.MarkFlagRequired("creds-path")
+	getBlobCredentialsCmd.MarkFlagRequired("blob-config")
+}
+
+// loadBlobConfig reads and parses the blob config file, returning the raw
+// bytes as well so they can be hashed into the inventory.
+func loadBlobConfig(path string) ([]byte, *config.AzureBlobConfig, error) {
+	blobConfigBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read blob config file: %w", err)
+	}
+
+	var blobConfig config.AzureBlobConfig
+	if err = yaml.Unmarshal(blobConfigBytes, &blobConfig); err != nil {
+		return nil, nil, fmt.Errorf("could not YAML unmarshal blob config: %w", err)
+	}
+
+	if err = blobConfig.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return nil, nil, fmt.Errorf("could not validate blob config: %w", err)
+	}
+
+	return blobConfigBytes, &blobConfig, nil
+}
@@ -4,19 +4,93 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
 
 	"github.com/spf13/cobra"
 )
 
+var planOnly bool
+
 // createCmd represents the create command.
 var createCmd = &cobra.Command{
-	Use:   "create",
+	Use:   "create <resource stack>",
 	Short: "Provision an Azure resource stack",
-	Long: fmt.Sprintf(`Provision an Azure resource stack.
+	Long: fmt.Sprintf(`Provision an Azure resource stack from its config.  Resources that already
+exist are updated.  With --plan the resources that would be created or updated
+are shown as JSON and nothing is changed.
 %s`, supportedResourceStacks),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resourceStack, err := loadStack(args[0], stackConfigPath)
+		if err != nil {
+			return err
+		}
+
+		if err = resourceStack.Validate(); err != nil {
+			return fmt.Errorf("could not validate %s config: %w", args[0], err)
+		}
+
+		// an interrupt stops composite stacks from starting more components
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if planOnly {
+			plan, err := resourceStack.Plan(ctx)
+			if err != nil {
+				return fmt.Errorf("could not plan %s stack: %w", args[0], err)
+			}
+
+			planBytes, err := json.MarshalIndent(plan, "", "  ")
+			if err != nil {
+				return fmt.Errorf("could not JSON marshal %s plan: %w", args[0], err)
+			}
+
+			fmt.Println(string(planBytes))
+
+			return nil
+		}
+
+		// Record the created resources so the stack can be deleted from them,
+		// stacks that fail part way still return what they created
+		stackInventory, err := resourceStack.Create(ctx)
+		if stackInventory != nil {
+			if writeErr := writeInventory(stackInventory, inventoryPath); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		outputs := resourceStack.Outputs()
+		keys := make([]string, 0, len(outputs))
+		for key := range outputs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			log.Printf("%s: %s", key, outputs[key])
+		}
+
+		return nil
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(createCmd)
+	addStackConfigFlags(createCmd)
+	createCmd.Flags().StringVarP(&azureCredentialsPath, "creds-path", "p", "",
+		"Location to JSON file containing Azure credentials. To generate one, use the Azure CLI and refer to command 'az ad sp create-for-rbac'")
+	createCmd.Flags().StringVarP(&inventoryPath, "inventory-file", "i", "",
+		"Location to write the inventory of created resources to. Defaults to <stack type>-<stack name>-inventory.json")
+	createCmd.Flags().BoolVar(&planOnly, "plan", false,
+		"Show the resources that would be created or updated without changing anything")
+
+	createCmd.MarkFlagRequired("creds-path")
 }
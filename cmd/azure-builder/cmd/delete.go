@@ -4,23 +4,95 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/nukleros/azure-builder/pkg/inventory"
+	"github.com/nukleros/azure-builder/pkg/stack"
 	"github.com/spf13/cobra"
 )
 
+var (
+	deleteResourceOnly bool
+	deleteSharedServer bool
+	forceDelete        bool
+)
+
 // deleteCmd represents the delete command.
 var deleteCmd = &cobra.Command{
-	Use:   "delete <resource stack> <inventory file>",
+	Use:   "delete <resource stack> [inventory file]",
 	Short: "Remove an Azure resource stack",
-	Long: fmt.Sprintf(`Remove an Azure resource stack.
+	Long: fmt.Sprintf(`Remove an Azure resource stack.  When an inventory file written by the create
+command is given, exactly the resources recorded in it are deleted in the
+reverse of the order they were created in and no config is needed.  Otherwise
+the resources described by the config are deleted.
 %s`, supportedResourceStacks),
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 2 {
+			return deleteFromInventory(args[0], args[1])
+		}
+
+		if stackConfigPath == "" {
+			return fmt.Errorf("either an inventory file or --config is required")
+		}
 
-		return nil
+		resourceStack, err := loadStack(args[0], stackConfigPath)
+		if err != nil {
+			return err
+		}
+
+		return resourceStack.Delete(context.Background(), stack.DeleteOptions{
+			ResourceOnly:       deleteResourceOnly,
+			Force:              forceDelete,
+			DeleteSharedServer: deleteSharedServer,
+		})
 	},
 }
 
+// deleteFromInventory tears down the resources recorded in an inventory file
+// for the given stack type.
+func deleteFromInventory(stackType string, inventoryFile string) error {
+	stackInventory, err := inventory.ReadInventory(inventoryFile)
+	if err != nil {
+		return err
+	}
+
+	if stackInventory.StackType != stackType {
+		return fmt.Errorf("inventory file is for a %s stack, not %s", stackInventory.StackType, stackType)
+	}
+
+	// Load credentials used to connect to Azure
+	session, err := loadAzureSession(azureCredentialsPath)
+	if err != nil {
+		return err
+	}
+
+	if err = inventory.Teardown(context.Background(), stackInventory, session, forceDelete); err != nil {
+		return fmt.Errorf("could not delete %s stack %s: %w", stackType, stackInventory.StackName, err)
+	}
+
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+	addStackConfigFlags(deleteCmd)
+	deleteCmd.Flags().StringVarP(&azureCredentialsPath, "creds-path", "p", "",
+		"Location to JSON file containing Azure credentials. To generate one, use the Azure CLI and refer to command 'az ad sp create-for-rbac'")
+	deleteCmd.Flags().BoolVar(&deleteResourceOnly, "resource-only", false,
+		"Delete only the main resource of the stack, keeping the resource group unless azure-builder created it and it is empty")
+	deleteCmd.Flags().BoolVar(&forceDelete, "force", false,
+		"Delete the resource group even if it was not created by azure-builder for this stack")
+	deleteCmd.Flags().BoolVar(&deleteSharedServer, "delete-shared-server", false,
+		"Delete a sql server even if it holds databases that are not in the config")
+
+	// the per-stack names of --resource-only
+	for _, flagName := range []string{"cluster-only", "account-only", "server-only"} {
+		deleteCmd.Flags().BoolVar(&deleteResourceOnly, flagName, false,
+			"Delete only the main resource of the stack")
+		deleteCmd.Flags().MarkHidden(flagName)
+	}
+
+	deleteCmd.MarkFlagRequired("creds-path")
 }
@@ -0,0 +1,54 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nukleros/azure-builder/pkg/stack"
+	"github.com/spf13/cobra"
+)
+
+var showSecrets bool
+
+// getCmd represents the get command.
+var getCmd = &cobra.Command{
+	Use:   "get <resource stack>",
+	Short: "Retrieve information about an Azure resource stack",
+	Long: fmt.Sprintf(`Retrieve information about an Azure resource stack and show it as JSON.
+Secrets such as passwords are left out unless --show-secrets is set.
+%s`, supportedResourceStacks),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resourceStack, err := loadStack(args[0], stackConfigPath)
+		if err != nil {
+			return err
+		}
+
+		stackInfo, err := resourceStack.Get(context.Background(), stack.GetOptions{ShowSecrets: showSecrets})
+		if err != nil {
+			return err
+		}
+
+		stackInfoBytes, err := json.MarshalIndent(stackInfo, "", "  ")
+		if err != nil {
+			return fmt.Errorf("could not JSON marshal %s stack: %w", args[0], err)
+		}
+
+		fmt.Println(string(stackInfoBytes))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	addStackConfigFlags(getCmd)
+	getCmd.Flags().StringVarP(&azureCredentialsPath, "creds-path", "p", "",
+		"Location to JSON file containing Azure credentials. To generate one, use the Azure CLI and refer to command 'az ad sp create-for-rbac'")
+	getCmd.Flags().BoolVar(&showSecrets, "show-secrets", false,
+		"Include secrets such as passwords in the output")
+}
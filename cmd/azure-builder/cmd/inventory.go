@@ -0,0 +1,47 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/nukleros/azure-builder/pkg/inventory"
+)
+
+var inventoryPath string
+
+// writeInventory writes the inventory of a created stack, defaulting the path
+// to one derived from the stack type and name. An inventory already written
+// by an earlier run of the stack is merged in, so resources created by that
+// run stay recorded.
+func writeInventory(stackInventory *inventory.Inventory, path string) error {
+	if path == "" {
+		path = fmt.Sprintf("%s-%s-inventory.json", stackInventory.StackType, stackInventory.StackName)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		previousInventory, err := inventory.ReadInventory(path)
+		if err != nil {
+			return err
+		}
+
+		if err = stackInventory.Merge(previousInventory); err != nil {
+			return fmt.Errorf("could not merge inventory file %s: %w", path, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not check for existing inventory file %s: %w", path, err)
+	}
+
+	if err := stackInventory.Write(path); err != nil {
+		return fmt.Errorf("could not write inventory for %s stack: %w", stackInventory.StackType, err)
+	}
+
+	log.Println("wrote inventory file:", path)
+
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-yaml/yaml"
+	"github.com/nukleros/azure-builder/pkg/aks"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	aksConfigPath        string
+	kubeconfigOutputPath string
+	kubeconfigMerge      bool
+	kubeconfigMergePath  string
+	kubeconfigContext    string
+	kubeconfigAdmin      bool
+)
+
+// getKubeconfigCmd represents the get command for an AKS cluster's kubeconfig.
+var getKubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "Retrieve the kubeconfig for an AKS cluster",
+	Long: `Retrieve the kubeconfig for an AKS cluster. The kubeconfig is written to stdout
+unless an output file is given, or merged into an existing kubeconfig with --merge.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if kubeconfigMerge && kubeconfigOutputPath != "" {
+			return fmt.Errorf("only one of --merge and --output can be used")
+		}
+
+		// Load credentials used to connect to Azure
+		session, err := loadAzureSession(azureCredentialsPath)
+		if err != nil {
+			return err
+		}
+
+		// Load aks config file used to create the cluster
+		aksConfigBytes, err := os.ReadFile(aksConfigPath)
+		if err != nil {
+			return fmt.Errorf("could not read aks config file: %w", err)
+		}
+
+		var aksConfig config.AzureAksConfig
+		if err = yaml.Unmarshal(aksConfigBytes, &aksConfig); err != nil {
+			return fmt.Errorf("could not YAML unmarshal aks config: %w", err)
+		}
+
+		if err = aksConfig.AzureResourceConfig.ValidateNotNull(); err != nil {
+			return fmt.Errorf("could not validate aks config: %w", err)
+		}
+
+		kubeconfigBytes, err := aks.GetKubeConfigForCluster(context.Background(), &aksConfig, session, kubeconfigAdmin)
+		if err != nil {
+			return fmt.Errorf("could not get kubeconfig for aks cluster: %w", err)
+		}
+
+		if kubeconfigMerge {
+			return mergeKubeconfig(kubeconfigBytes)
+		}
+
+		if kubeconfigContext != "" {
+			if kubeconfigBytes, err = aks.RenameKubeConfigContext(kubeconfigBytes, kubeconfigContext); err != nil {
+				return fmt.Errorf("could not rename kubeconfig context: %w", err)
+			}
+		}
+
+		if kubeconfigOutputPath == "" {
+			fmt.Print(string(kubeconfigBytes))
+			return nil
+		}
+
+		if err = os.WriteFile(kubeconfigOutputPath, kubeconfigBytes, 0600); err != nil {
+			return fmt.Errorf("could not write kubeconfig file: %w", err)
+		}
+
+		return nil
+	},
+}
+
+// mergeKubeconfig merges the cluster's kubeconfig into the kubeconfig at the
+// merge path, creating it if it does not exist yet.
+func mergeKubeconfig(kubeconfigBytes []byte) error {
+	mergePath := kubeconfigMergePath
+	if mergePath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("could not find home directory for default kubeconfig: %w", err)
+		}
+		mergePath = filepath.Join(homeDir, ".kube", "config")
+	}
+
+	existingBytes, err := os.ReadFile(mergePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not read kubeconfig file %s: %w", mergePath, err)
+	}
+
+	mergedBytes, err := aks.MergeKubeConfig(existingBytes, kubeconfigBytes, kubeconfigContext)
+	if err != nil {
+		return fmt.Errorf("could not merge kubeconfig: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(mergePath), 0700); err != nil {
+		return fmt.Errorf("could not create kubeconfig directory: %w", err)
+	}
+
+	if err = os.WriteFile(mergePath, mergedBytes, 0600); err != nil {
+		return fmt.Errorf("could not write kubeconfig file %s: %w", mergePath, err)
+	}
+
+	return nil
+}
+
+func init() {
+	getCmd.AddCommand(getKubeconfigCmd)
+	getKubeconfigCmd.Flags().StringVarP(&aksConfigPath, "aks-config", "c", "",
+		"Location to aks config used to create the resource")
+	getKubeconfigCmd.Flags().StringVarP(&azureCredentialsPath, "creds-path", "p", "",
+		"Location to JSON file containing Azure credentials. To generate one, use the Azure CLI and refer to command 'az ad sp create-for-rbac'")
+	getKubeconfigCmd.Flags().StringVarP(&kubeconfigOutputPath, "output", "o", "",
+		"File to write the kubeconfig to. Defaults to stdout")
+	getKubeconfigCmd.Flags().BoolVar(&kubeconfigMerge, "merge", false,
+		"Merge the kubeconfig into an existing kubeconfig file")
+	getKubeconfigCmd.Flags().StringVar(&kubeconfigMergePath, "kubeconfig", "",
+		"Kubeconfig file to merge into. Defaults to ~/.kube/config")
+	getKubeconfigCmd.Flags().StringVar(&kubeconfigContext, "context", "",
+		"Name of the kubeconfig context for the cluster")
+	getKubeconfigCmd.Flags().BoolVar(&kubeconfigAdmin, "admin", false,
+		"Retrieve cluster admin credentials instead of cluster user credentials")
+
+	getKubeconfigCmd.MarkFlagRequired("creds-path")
+	getKubeconfigCmd.MarkFlagRequired("aks-config")
+}
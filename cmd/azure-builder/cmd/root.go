@@ -7,12 +7,13 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/nukleros/azure-builder/pkg/stack"
 	"github.com/spf13/cobra"
 )
 
-const supportedResourceStacks = `
-Supported resource stacks:
-* aks (Azure Kubernetes Service)`
+// supportedResourceStacks lists the registered resource stacks for the help
+// text of the commands.
+var supportedResourceStacks = stack.SupportedStacks()
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -0,0 +1,33 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// loadAzureSession reads the credentials file used to connect to Azure and
+// builds the session shared by every client the command creates.
+func loadAzureSession(credentialsPath string) (*config.AzureSession, error) {
+	credsFileBytes, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials file: %w", err)
+	}
+
+	var credentialsConfig config.AzureCredentialsConfig
+	if err = json.Unmarshal(credsFileBytes, &credentialsConfig); err != nil {
+		return nil, fmt.Errorf("could not JSON unmarshal credentials config: %w", err)
+	}
+
+	session, err := config.NewAzureSession(&credentialsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not create azure session: %w", err)
+	}
+
+	return session, nil
+}
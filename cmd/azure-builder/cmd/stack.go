@@ -0,0 +1,55 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nukleros/azure-builder/pkg/stack"
+	"github.com/spf13/cobra"
+)
+
+var stackConfigPath string
+
+// loadStack builds the named resource stack from its config file and the
+// Azure credentials.
+func loadStack(stackType string, configPath string) (stack.Stack, error) {
+	definition, err := stack.Lookup(stackType)
+	if err != nil {
+		return nil, err
+	}
+
+	if configPath == "" {
+		return nil, fmt.Errorf("--config is required for %s stacks", stackType)
+	}
+
+	// Load credentials used to connect to Azure
+	session, err := loadAzureSession(azureCredentialsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load config file used to create the stack
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s config file: %w", stackType, err)
+	}
+
+	return definition.New(configBytes, session)
+}
+
+// addStackConfigFlags adds the --config flag and a hidden --<stack>-config
+// alias for each registered stack, which is what the flag was called before
+// the commands were shared by all stacks.
+func addStackConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&stackConfigPath, "config", "c", "",
+		"Location to config used to create the resource stack")
+	for _, name := range stack.Names() {
+		flagName := fmt.Sprintf("%s-config", name)
+		cmd.Flags().StringVar(&stackConfigPath, flagName, "",
+			fmt.Sprintf("Location to %s config used to create the resource", name))
+		cmd.Flags().MarkHidden(flagName)
+	}
+}
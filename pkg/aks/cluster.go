@@ -12,46 +12,64 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v2"
 	"github.com/nukleros/azure-builder/pkg/config"
 	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
 )
 
+// AksCluster is the output of creating an aks stack. It is returned once the
+// resource group exists, also when creating the cluster or its node pools
+// failed, and Cluster is nil when the cluster was not created.
+type AksCluster struct {
+	Cluster *armcontainerservice.ManagedCluster
+}
+
 func CreateAksCluster(
-	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
-) (*armcontainerservice.ManagedCluster, error) {
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+	ctx context.Context,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+) (*AksCluster, error) {
+	if err := aksConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate aks config: %w", err)
 	}
 
-	ctx := context.Background()
-
-	resourceGroup, err := resourcegroup.CreateResourceGroup(aksConfig, credentialsConfig, ctx)
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&aksConfig.AzureResourceConfig, session, ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not create the resource group: %w", err)
 	}
 
 	log.Println("created resource group id:", *resourceGroup.ID)
 
-	managedCluster, err := createManagedCluster(ctx, aksConfig, credentialsConfig)
+	aksCluster := &AksCluster{}
+
+	managedCluster, created, err := createManagedCluster(ctx, aksConfig, session)
 	if err != nil {
-		return nil, fmt.Errorf("could not create managed aks cluster: %w", err)
+		return aksCluster, fmt.Errorf("could not create managed aks cluster: %w", err)
 	}
+	aksCluster.Cluster = managedCluster
 
 	log.Println("created aks cluster id:", *managedCluster.ID)
-	return managedCluster, nil
+
+	// a cluster created in this run already has its initial system pool as
+	// configured, so only the other pools are put through the agent pools API
+	var createdPools []string
+	if created {
+		createdPools = append(createdPools, *aksConfig.GetInitialSystemPool().Name)
+	}
+
+	if err := createOrUpdateNodePools(ctx, aksConfig, session, createdPools); err != nil {
+		return aksCluster, fmt.Errorf("could not create node pools for aks cluster: %w", err)
+	}
+
+	return aksCluster, nil
 }
 
 func GetAksCluster(
 	ctx context.Context,
-	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
 ) (*armcontainerservice.ManagedCluster, error) {
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
-	}
-
-	managedClustersClient, err := credentialsConfig.CreateAzureManagedClustersClient(*aksConfig.ResourceGroup)
+	managedClustersClient, err := session.CreateAzureManagedClustersClient()
 	if err != nil {
-		return nil, fmt.Errorf("could not create managed clusters client from credentials config: %w", err)
+		return nil, fmt.Errorf("could not create managed clusters client from session: %w", err)
 	}
 
 	clusterResponse, err := managedClustersClient.Get(ctx, *aksConfig.ResourceGroup, *aksConfig.Name, nil)
@@ -62,103 +80,177 @@ func GetAksCluster(
 	return &clusterResponse.ManagedCluster, nil
 }
 
+// createManagedCluster creates the cluster with its initial system pool and
+// returns true when the cluster did not exist yet.
 func createManagedCluster(
 	ctx context.Context,
-	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
-) (*armcontainerservice.ManagedCluster, error) {
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+) (*armcontainerservice.ManagedCluster, bool, error) {
+	managedClustersClient, err := session.CreateAzureManagedClustersClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create managed clusters client from session: %w", err)
 	}
 
-	managedClustersClient, err := credentialsConfig.CreateAzureManagedClustersClient(*aksConfig.ResourceGroup)
-	if err != nil {
-		return nil, fmt.Errorf("could not create managed clusters client from credentials config: %w", err)
+	// node pools of an existing cluster are reconciled through the agent pools
+	// API, so the cluster itself is left untouched
+	existingCluster, err := managedClustersClient.Get(ctx, *aksConfig.ResourceGroup, *aksConfig.Name, nil)
+	if err == nil {
+		log.Printf("aks cluster %s already exists", *aksConfig.Name)
+		return &existingCluster.ManagedCluster, false, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, false, fmt.Errorf("could not check for existing aks cluster %s: %w", *aksConfig.Name, err)
+	}
+
+	managedCluster := armcontainerservice.ManagedCluster{
+		Location: aksConfig.Region,
+		Properties: &armcontainerservice.ManagedClusterProperties{
+			DNSPrefix: to.Ptr("aksgosdk"),
+			AgentPoolProfiles: []*armcontainerservice.ManagedClusterAgentPoolProfile{
+				agentPoolProfile(aksConfig.GetInitialSystemPool()),
+			},
+		},
+	}
+
+	// only a client secret credential gives us a service principal the cluster
+	// can run as, every other credential type falls back to a managed identity
+	credentialsConfig := session.CredentialsConfig
+	if credentialsConfig.GetType() == config.CredentialTypeClientSecret {
+		managedCluster.Properties.ServicePrincipalProfile = &armcontainerservice.ManagedClusterServicePrincipalProfile{
+			ClientID: credentialsConfig.ClientID,
+			Secret:   credentialsConfig.ClientSecret,
+		}
+	} else {
+		managedCluster.Identity = &armcontainerservice.ManagedClusterIdentity{
+			Type: to.Ptr(armcontainerservice.ResourceIdentityTypeSystemAssigned),
+		}
 	}
 
 	pollerResp, err := managedClustersClient.BeginCreateOrUpdate(
 		ctx,
 		*aksConfig.ResourceGroup,
 		*aksConfig.Name,
-		armcontainerservice.ManagedCluster{
-			Location: aksConfig.Region,
-			Properties: &armcontainerservice.ManagedClusterProperties{
-				DNSPrefix: to.Ptr("aksgosdk"),
-				AgentPoolProfiles: []*armcontainerservice.ManagedClusterAgentPoolProfile{
-					{
-						Name:              to.Ptr("askagent"),
-						Count:             to.Ptr[int32](1),
-						VMSize:            to.Ptr("Standard_DS2_v2"),
-						MaxPods:           to.Ptr[int32](110),
-						MinCount:          to.Ptr[int32](1),
-						MaxCount:          to.Ptr[int32](100),
-						OSType:            to.Ptr(armcontainerservice.OSTypeLinux),
-						Type:              to.Ptr(armcontainerservice.AgentPoolTypeVirtualMachineScaleSets),
-						EnableAutoScaling: to.Ptr(true),
-						Mode:              to.Ptr(armcontainerservice.AgentPoolModeSystem),
-					},
-				},
-				ServicePrincipalProfile: &armcontainerservice.ManagedClusterServicePrincipalProfile{
-					ClientID: credentialsConfig.ClientID,
-					Secret:   credentialsConfig.ClientSecret,
-				},
-			},
-		},
+		managedCluster,
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run BeginCreateOrUpdate for aks cluster: %w", err)
+		return nil, false, fmt.Errorf("failed to run BeginCreateOrUpdate for aks cluster: %w", err)
 	}
 	resp, err := pollerResp.PollUntilDone(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to poll for completion response for create aks cluster: %w", err)
+		return nil, false, fmt.Errorf("failed to poll for completion response for create aks cluster: %w", err)
 	}
 
-	return &resp.ManagedCluster, nil
+	return &resp.ManagedCluster, true, nil
 }
 
+// GetKubeConfigForCluster returns the kubeconfig for the cluster. Admin
+// credentials bypass Kubernetes RBAC and should only be requested when needed,
+// user credentials are returned otherwise.
 func GetKubeConfigForCluster(
 	ctx context.Context,
-	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+	admin bool,
 ) ([]byte, error) {
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
-	}
-
-	managedClustersClient, err := credentialsConfig.CreateAzureManagedClustersClient(*aksConfig.ResourceGroup)
+	managedClustersClient, err := session.CreateAzureManagedClustersClient()
 	if err != nil {
-		return nil, fmt.Errorf("could not create managed clusters client from credentials config: %w", err)
+		return nil, fmt.Errorf("could not create managed clusters client from session: %w", err)
 	}
 
 	// get kubeconfig for the cluster
-	adminClusterCredentials, err := managedClustersClient.ListClusterAdminCredentials(ctx, *aksConfig.ResourceGroup, *aksConfig.Name, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not list cluster credentials: %w", err)
+	var kubeconfigs []*armcontainerservice.CredentialResult
+	if admin {
+		adminClusterCredentials, err := managedClustersClient.ListClusterAdminCredentials(ctx, *aksConfig.ResourceGroup, *aksConfig.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not list cluster admin credentials: %w", err)
+		}
+		kubeconfigs = adminClusterCredentials.Kubeconfigs
+	} else {
+		userClusterCredentials, err := managedClustersClient.ListClusterUserCredentials(ctx, *aksConfig.ResourceGroup, *aksConfig.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not list cluster user credentials: %w", err)
+		}
+		kubeconfigs = userClusterCredentials.Kubeconfigs
 	}
 
-	if len(adminClusterCredentials.Kubeconfigs) == 0 {
+	if len(kubeconfigs) == 0 {
 		return nil, fmt.Errorf("could not retrieve any kube config for created cluster")
 	}
 
-	return adminClusterCredentials.Kubeconfigs[0].Value, nil
+	return kubeconfigs[0].Value, nil
 }
 
+// DeleteMode controls how much of an aks stack is removed on delete.
+type DeleteMode int
+
+const (
+	// DeleteModeResourceGroup deletes the entire resource group the cluster
+	// was provisioned in.
+	DeleteModeResourceGroup DeleteMode = iota
+
+	// DeleteModeClusterOnly deletes the managed cluster, which has Azure remove
+	// its node resource group, and only deletes the cluster's resource group
+	// when azure-builder created it and nothing else is left in it.
+	DeleteModeClusterOnly
+)
+
 func DeleteAksCluster(
-	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	ctx context.Context,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+	deleteMode DeleteMode,
+	force bool,
 ) error {
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return fmt.Errorf("could not validate credentials config: %w", err)
-	}
+	if deleteMode == DeleteModeClusterOnly {
+		if err := deleteManagedCluster(ctx, aksConfig, session); err != nil {
+			return fmt.Errorf("could not delete managed aks cluster: %w", err)
+		}
+
+		if err := resourcegroup.CleanupEmptyResourceGroup(&aksConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the aks cluster: %w", err)
+		}
 
-	ctx := context.TODO()
+		return nil
+	}
 
 	// delete the entire resource group that was provisioned for the cluster, this ensures that azure handles all the
 	// individual resources the correspond the to the aks cluster deployment
-	if err := resourcegroup.CleanupResourceGroup(aksConfig, credentialsConfig, ctx); err != nil {
+	if err := resourcegroup.CleanupResourceGroup(&aksConfig.AzureResourceConfig, session, ctx, force); err != nil {
 		return fmt.Errorf("could not clean up resource group for the aks cluster: %w", err)
 	}
 
 	return nil
 }
+
+// deleteManagedCluster deletes the managed cluster. Azure removes the
+// cluster's node resource group along with it.
+func deleteManagedCluster(
+	ctx context.Context,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+) error {
+	managedClustersClient, err := session.CreateAzureManagedClustersClient()
+	if err != nil {
+		return fmt.Errorf("could not create managed clusters client from session: %w", err)
+	}
+
+	log.Printf("deleting aks cluster %s...", *aksConfig.Name)
+	pollerResp, err := managedClustersClient.BeginDelete(ctx, *aksConfig.ResourceGroup, *aksConfig.Name, nil)
+	if err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("aks cluster %s does not exist", *aksConfig.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to run BeginDelete for aks cluster %s: %w", *aksConfig.Name, err)
+	}
+
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to poll for completion response on delete aks cluster %s: %w", *aksConfig.Name, err)
+	}
+
+	log.Printf("deleted aks cluster %s", *aksConfig.Name)
+
+	return nil
+}
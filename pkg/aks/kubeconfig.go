@@ -0,0 +1,111 @@
+package aks
+
+import (
+	"fmt"
+
+	"github.com/go-yaml/yaml"
+)
+
+// kubeConfig holds the parts of a kubeconfig file needed to rename and merge
+// entries. Any other top level fields are carried through untouched.
+type kubeConfig struct {
+	APIVersion     string                 `yaml:"apiVersion,omitempty"`
+	Kind           string                 `yaml:"kind,omitempty"`
+	Clusters       []kubeConfigEntry      `yaml:"clusters"`
+	Contexts       []kubeConfigEntry      `yaml:"contexts"`
+	Users          []kubeConfigEntry      `yaml:"users"`
+	CurrentContext string                 `yaml:"current-context"`
+	Rest           map[string]interface{} `yaml:",inline"`
+}
+
+// kubeConfigEntry is a named cluster, context or user in a kubeconfig file.
+type kubeConfigEntry struct {
+	Name    string                 `yaml:"name"`
+	Cluster map[string]interface{} `yaml:"cluster,omitempty"`
+	Context map[string]interface{} `yaml:"context,omitempty"`
+	User    map[string]interface{} `yaml:"user,omitempty"`
+}
+
+// RenameKubeConfigContext renames the current context of a kubeconfig.
+func RenameKubeConfigContext(kubeConfigBytes []byte, contextName string) ([]byte, error) {
+	var config kubeConfig
+	if err := yaml.Unmarshal(kubeConfigBytes, &config); err != nil {
+		return nil, fmt.Errorf("could not YAML unmarshal kubeconfig: %w", err)
+	}
+
+	if err := config.renameCurrentContext(contextName); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(&config)
+}
+
+// MergeKubeConfig merges the clusters, contexts and users of a cluster's
+// kubeconfig into an existing kubeconfig, replacing any entries with the same
+// name, and makes the merged context the current one. When contextName is
+// set the merged context is renamed to it.
+func MergeKubeConfig(existingBytes []byte, clusterBytes []byte, contextName string) ([]byte, error) {
+	var existing kubeConfig
+	if err := yaml.Unmarshal(existingBytes, &existing); err != nil {
+		return nil, fmt.Errorf("could not YAML unmarshal existing kubeconfig: %w", err)
+	}
+
+	var cluster kubeConfig
+	if err := yaml.Unmarshal(clusterBytes, &cluster); err != nil {
+		return nil, fmt.Errorf("could not YAML unmarshal cluster kubeconfig: %w", err)
+	}
+
+	if contextName != "" {
+		if err := cluster.renameCurrentContext(contextName); err != nil {
+			return nil, err
+		}
+	}
+
+	if existing.APIVersion == "" {
+		existing.APIVersion = cluster.APIVersion
+	}
+
+	if existing.Kind == "" {
+		existing.Kind = cluster.Kind
+	}
+
+	existing.Clusters = mergeKubeConfigEntries(existing.Clusters, cluster.Clusters)
+	existing.Contexts = mergeKubeConfigEntries(existing.Contexts, cluster.Contexts)
+	existing.Users = mergeKubeConfigEntries(existing.Users, cluster.Users)
+	existing.CurrentContext = cluster.CurrentContext
+
+	return yaml.Marshal(&existing)
+}
+
+func (config *kubeConfig) renameCurrentContext(contextName string) error {
+	for i := range config.Contexts {
+		if config.Contexts[i].Name == config.CurrentContext {
+			config.Contexts[i].Name = contextName
+			config.CurrentContext = contextName
+			return nil
+		}
+	}
+
+	return fmt.Errorf("could not find current context %s in kubeconfig", config.CurrentContext)
+}
+
+// mergeKubeConfigEntries replaces existing entries that share a name with an
+// added entry and appends the rest.
+func mergeKubeConfigEntries(existing []kubeConfigEntry, added []kubeConfigEntry) []kubeConfigEntry {
+	for _, entry := range added {
+		replaced := false
+		for i := range existing {
+			if existing[i].Name == entry.Name {
+				existing[i] = entry
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			existing = append(existing, entry)
+		}
+	}
+
+	return existing
+}
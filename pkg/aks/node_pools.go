@@ -0,0 +1,157 @@
+package aks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v2"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// CreateOrUpdateNodePools creates every node pool in the aks config that does
+// not exist yet on the cluster and updates the ones that do, which allows
+// pools to be added to a cluster after it was created. Pools that exist on the
+// cluster but are missing from the config are left alone.
+func CreateOrUpdateNodePools(
+	ctx context.Context,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+) error {
+	return createOrUpdateNodePools(ctx, aksConfig, session, nil)
+}
+
+// createOrUpdateNodePools reconciles the node pools in the aks config except
+// the skipped ones, which are already up to date.
+func createOrUpdateNodePools(
+	ctx context.Context,
+	aksConfig *config.AzureAksConfig,
+	session *config.AzureSession,
+	skipPools []string,
+) error {
+	agentPoolsClient, err := session.CreateAzureAgentPoolsClient()
+	if err != nil {
+		return fmt.Errorf("could not create agent pools client from session: %w", err)
+	}
+
+	for _, pool := range aksConfig.GetNodePools() {
+		if slices.Contains(skipPools, *pool.Name) {
+			continue
+		}
+
+		pollerResp, err := agentPoolsClient.BeginCreateOrUpdate(
+			ctx,
+			*aksConfig.ResourceGroup,
+			*aksConfig.Name,
+			*pool.Name,
+			armcontainerservice.AgentPool{
+				Properties: agentPoolProperties(pool),
+			},
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to run BeginCreateOrUpdate for node pool %s: %w", *pool.Name, err)
+		}
+
+		resp, err := pollerResp.PollUntilDone(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to poll for completion response for node pool %s: %w", *pool.Name, err)
+		}
+
+		log.Println("reconciled node pool id:", *resp.AgentPool.ID)
+	}
+
+	return nil
+}
+
+// agentPoolProperties converts a node pool config into the properties sent to
+// the agent pools API.
+func agentPoolProperties(pool *config.AksNodePoolConfig) *armcontainerservice.ManagedClusterAgentPoolProfileProperties {
+	properties := &armcontainerservice.ManagedClusterAgentPoolProfileProperties{
+		Count:             to.Ptr(pool.GetNodeCount()),
+		VMSize:            to.Ptr(pool.GetVMSize()),
+		MaxPods:           to.Ptr(pool.GetMaxPods()),
+		OSDiskSizeGB:      pool.OSDiskSizeGB,
+		OSType:            to.Ptr(armcontainerservice.OSTypeLinux),
+		Type:              to.Ptr(armcontainerservice.AgentPoolTypeVirtualMachineScaleSets),
+		EnableAutoScaling: to.Ptr(pool.GetEnableAutoScaling()),
+		Mode:              to.Ptr(armcontainerservice.AgentPoolMode(pool.GetMode())),
+		ScaleSetPriority:  to.Ptr(armcontainerservice.ScaleSetPriority(pool.GetPriority())),
+	}
+
+	if pool.GetEnableAutoScaling() {
+		properties.MinCount = to.Ptr(pool.GetMinCount())
+		properties.MaxCount = to.Ptr(pool.GetMaxCount())
+	}
+
+	if pool.GetPriority() == config.AksNodePoolPrioritySpot {
+		properties.ScaleSetEvictionPolicy = to.Ptr(armcontainerservice.ScaleSetEvictionPolicy(pool.GetEvictionPolicy()))
+		properties.SpotMaxPrice = to.Ptr(pool.GetSpotMaxPrice())
+	}
+
+	if pool.OSDiskType != nil {
+		properties.OSDiskType = to.Ptr(armcontainerservice.OSDiskType(*pool.OSDiskType))
+	}
+
+	if pool.OSSKU != nil {
+		properties.OSSKU = to.Ptr(osSKU(*pool.OSSKU))
+	}
+
+	for _, zone := range pool.AvailabilityZones {
+		properties.AvailabilityZones = append(properties.AvailabilityZones, to.Ptr(zone))
+	}
+
+	if len(pool.NodeLabels) > 0 {
+		properties.NodeLabels = make(map[string]*string, len(pool.NodeLabels))
+		for key, value := range pool.NodeLabels {
+			properties.NodeLabels[key] = to.Ptr(value)
+		}
+	}
+
+	for _, taint := range pool.NodeTaints {
+		properties.NodeTaints = append(properties.NodeTaints, to.Ptr(taint))
+	}
+
+	return properties
+}
+
+// agentPoolProfile converts a node pool config into the agent pool profile
+// sent with the cluster create request.
+func agentPoolProfile(pool *config.AksNodePoolConfig) *armcontainerservice.ManagedClusterAgentPoolProfile {
+	properties := agentPoolProperties(pool)
+
+	return &armcontainerservice.ManagedClusterAgentPoolProfile{
+		Name:                   pool.Name,
+		Count:                  properties.Count,
+		VMSize:                 properties.VMSize,
+		MaxPods:                properties.MaxPods,
+		MinCount:               properties.MinCount,
+		MaxCount:               properties.MaxCount,
+		OSDiskSizeGB:           properties.OSDiskSizeGB,
+		OSDiskType:             properties.OSDiskType,
+		OSSKU:                  properties.OSSKU,
+		OSType:                 properties.OSType,
+		Type:                   properties.Type,
+		EnableAutoScaling:      properties.EnableAutoScaling,
+		Mode:                   properties.Mode,
+		ScaleSetPriority:       properties.ScaleSetPriority,
+		ScaleSetEvictionPolicy: properties.ScaleSetEvictionPolicy,
+		SpotMaxPrice:           properties.SpotMaxPrice,
+		AvailabilityZones:      properties.AvailabilityZones,
+		NodeLabels:             properties.NodeLabels,
+		NodeTaints:             properties.NodeTaints,
+	}
+}
+
+// osSKU maps the OS SKU names used in the aks config to the names known by the
+// container service API version in use, which still calls Azure Linux by its
+// former CBLMariner name.
+func osSKU(sku string) armcontainerservice.OSSKU {
+	if sku == config.AksOSSKUAzureLinux {
+		return armcontainerservice.OSSKUCBLMariner
+	}
+
+	return armcontainerservice.OSSKU(sku)
+}
@@ -1,4 +1,4 @@
-package main
+package blob
 
 import (
 	"context"
@@ -8,74 +8,167 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
 	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/keyvault"
 	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
 )
 
+// CreateBlobStore creates the storage account with its containers, queues and
+// file shares. Once the resource group exists the blob store is returned also
+// when a later step fails, with Account nil when the account was not created.
 func CreateBlobStore(
-	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
-) (*armstorage.Account, error) {
-
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+) (*BlobStore, error) {
+	if err := blobConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate blob config: %w", err)
 	}
 
-	ctx := context.Background()
+	var customerManagedKey *keyvault.CustomerManagedKey
+	if blobConfig.CustomerManagedKey != nil {
+		key, err := keyvault.CheckCustomerManagedKey(ctx, blobConfig.CustomerManagedKey, session)
+		if err != nil {
+			return nil, fmt.Errorf("could not verify customer managed key: %w", err)
+		}
+		customerManagedKey = key
+	}
 
-	resourceGroup, err := resourcegroup.CreateResourceGroup(aksConfig, credentialsConfig, ctx)
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&blobConfig.AzureResourceConfig, session, ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not create the resource group: %w", err)
 	}
 
 	log.Println("created resource group id:", *resourceGroup.ID)
 
-	storageAccount, err := createStorageAccount(ctx, aksConfig, credentialsConfig)
+	blobStore := &BlobStore{}
+
+	storageAccount, err := createStorageAccount(ctx, blobConfig, customerManagedKey, session)
 	if err != nil {
-		return nil, fmt.Errorf("could not create the blob storage account: %w", err)
+		return blobStore, fmt.Errorf("could not create the blob storage account: %w", err)
 	}
+	blobStore.Account = storageAccount
 
 	log.Println("created blob storage account:", *storageAccount.ID)
-	return storageAccount, nil
+
+	if err := ConfigureDataProtection(ctx, blobConfig, session); err != nil {
+		return blobStore, fmt.Errorf("could not configure data protection: %w", err)
+	}
+
+	if err := ConfigureLifecyclePolicy(ctx, blobConfig, session); err != nil {
+		return blobStore, fmt.Errorf("could not configure lifecycle policy: %w", err)
+	}
+
+	if err := ReconcileBlobResources(ctx, blobConfig, session, blobStore); err != nil {
+		return blobStore, fmt.Errorf("could not create blob storage account resources: %w", err)
+	}
+
+	return blobStore, nil
+}
+
+func GetBlobStore(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+) (*BlobStore, error) {
+	accountsClient, err := session.CreateStorageAccountsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage accounts client from session: %w", err)
+	}
+
+	accountResponse, err := accountsClient.GetProperties(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get storage account %s: %w", *blobConfig.Name, err)
+	}
+
+	blobStore := &BlobStore{Account: &accountResponse.Account}
+	if err := getBlobResources(ctx, blobConfig, session, blobStore); err != nil {
+		return nil, err
+	}
+
+	return blobStore, nil
 }
 
 func createStorageAccount(
 	ctx context.Context,
-	storageConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	storageConfig *config.AzureBlobConfig,
+	customerManagedKey *keyvault.CustomerManagedKey,
+	session *config.AzureSession,
 ) (*armstorage.Account, error) {
 
-	accountsClient, err := credentialsConfig.CreateStorageAccountsClient()
+	accountsClient, err := session.CreateStorageAccountsClient()
 	if err != nil {
 		return nil, fmt.Errorf("could not validate storage account: %w", err)
 	}
 
+	properties := &armstorage.AccountPropertiesCreateParameters{
+		EnableHTTPSTrafficOnly: to.Ptr(true),
+		IsHnsEnabled:           storageConfig.EnableHierarchicalNamespace,
+		MinimumTLSVersion:      to.Ptr(armstorage.MinimumTLSVersion(storageConfig.GetMinimumTLSVersion())),
+		AllowBlobPublicAccess:  to.Ptr(storageConfig.GetAllowBlobPublicAccess()),
+		AllowSharedKeyAccess:   storageConfig.AllowSharedKeyAccess,
+		Encryption: &armstorage.Encryption{
+			Services: &armstorage.EncryptionServices{
+				File: &armstorage.EncryptionService{
+					KeyType: to.Ptr(armstorage.KeyTypeAccount),
+					Enabled: to.Ptr(true),
+				},
+				Blob: &armstorage.EncryptionService{
+					KeyType: to.Ptr(armstorage.KeyTypeAccount),
+					Enabled: to.Ptr(true),
+				},
+			},
+			KeySource: to.Ptr(armstorage.KeySourceMicrosoftStorage),
+		},
+	}
+
+	if accessTier := storageConfig.GetAccessTier(); accessTier != "" {
+		properties.AccessTier = to.Ptr(armstorage.AccessTier(accessTier))
+	}
+
+	parameters := armstorage.AccountCreateParameters{
+		Kind: to.Ptr(armstorage.Kind(storageConfig.GetKind())),
+		SKU: &armstorage.SKU{
+			Name: to.Ptr(armstorage.SKUName(storageConfig.GetSKU())),
+		},
+		Location:   storageConfig.Region,
+		Properties: properties,
+	}
+
+	// with a customer managed key the account is encrypted with the key vault
+	// key through the user-assigned identity. An empty key version lets the
+	// account follow key rotations.
+	if customerManagedKey != nil {
+		parameters.Identity = &armstorage.Identity{
+			Type: to.Ptr(armstorage.IdentityTypeUserAssigned),
+			UserAssignedIdentities: map[string]*armstorage.UserAssignedIdentity{
+				customerManagedKey.IdentityID: {},
+			},
+		}
+
+		keyVersion := customerManagedKey.KeyVersion
+		if customerManagedKey.AutoRotation {
+			keyVersion = ""
+		}
+
+		properties.Encryption.KeySource = to.Ptr(armstorage.KeySourceMicrosoftKeyvault)
+		properties.Encryption.KeyVaultProperties = &armstorage.KeyVaultProperties{
+			KeyVaultURI: to.Ptr(customerManagedKey.VaultURI),
+			KeyName:     to.Ptr(customerManagedKey.KeyName),
+			KeyVersion:  to.Ptr(keyVersion),
+		}
+		properties.Encryption.EncryptionIdentity = &armstorage.EncryptionIdentity{
+			EncryptionUserAssignedIdentity: to.Ptr(customerManagedKey.IdentityID),
+		}
+	}
+
 	pollerResp, err := accountsClient.BeginCreate(
 		ctx,
 		*storageConfig.ResourceGroup,
 		*storageConfig.Name,
-		armstorage.AccountCreateParameters{
-			Kind: to.Ptr(armstorage.KindStorageV2),
-			SKU: &armstorage.SKU{
-				Name: to.Ptr(armstorage.SKUNameStandardLRS),
-			},
-			Location: storageConfig.Region,
-			Properties: &armstorage.AccountPropertiesCreateParameters{
-				AccessTier: to.Ptr(armstorage.AccessTierCool),
-				Encryption: &armstorage.Encryption{
-					Services: &armstorage.EncryptionServices{
-						File: &armstorage.EncryptionService{
-							KeyType: to.Ptr(armstorage.KeyTypeAccount),
-							Enabled: to.Ptr(true),
-						},
-						Blob: &armstorage.EncryptionService{
-							KeyType: to.Ptr(armstorage.KeyTypeAccount),
-							Enabled: to.Ptr(true),
-						},
-					},
-					KeySource: to.Ptr(armstorage.KeySourceMicrosoftStorage),
-				},
-			},
-		}, nil)
+		parameters,
+		nil,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -85,3 +178,67 @@ func createStorageAccount(
 	}
 	return &resp.Account, nil
 }
+
+// DeleteMode controls how much of a blob stack is removed on delete.
+type DeleteMode int
+
+const (
+	// DeleteModeResourceGroup deletes the entire resource group the storage
+	// account was provisioned in.
+	DeleteModeResourceGroup DeleteMode = iota
+
+	// DeleteModeAccountOnly deletes the storage account and only deletes its
+	// resource group when azure-builder created it and nothing else is left in
+	// it.
+	DeleteModeAccountOnly
+)
+
+func DeleteBlobStore(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+	deleteMode DeleteMode,
+	force bool,
+) error {
+	if deleteMode == DeleteModeAccountOnly {
+		if err := deleteStorageAccount(ctx, blobConfig, session); err != nil {
+			return fmt.Errorf("could not delete the blob storage account: %w", err)
+		}
+
+		if err := resourcegroup.CleanupEmptyResourceGroup(&blobConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the blob storage account: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := resourcegroup.CleanupResourceGroup(&blobConfig.AzureResourceConfig, session, ctx, force); err != nil {
+		return fmt.Errorf("could not clean up resource group for the blob storage account: %w", err)
+	}
+
+	return nil
+}
+
+func deleteStorageAccount(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+) error {
+	accountsClient, err := session.CreateStorageAccountsClient()
+	if err != nil {
+		return fmt.Errorf("could not create storage accounts client from session: %w", err)
+	}
+
+	log.Printf("deleting blob storage account %s...", *blobConfig.Name)
+	if _, err = accountsClient.Delete(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, nil); err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("blob storage account %s does not exist", *blobConfig.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to run Delete for storage account %s: %w", *blobConfig.Name, err)
+	}
+
+	log.Printf("deleted blob storage account %s", *blobConfig.Name)
+
+	return nil
+}
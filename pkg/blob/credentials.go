@@ -0,0 +1,253 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/go-yaml/yaml"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// Names of the storage account keys.
+const (
+	AccountKeyPrimary   = "key1"
+	AccountKeySecondary = "key2"
+)
+
+// StorageCredentials are the credentials applications use to connect to a
+// storage account. The SAS fields are only set when a SAS was requested.
+type StorageCredentials struct {
+	AccountName      string `json:"accountName"`
+	AccountKey       string `json:"accountKey"`
+	BlobEndpoint     string `json:"blobEndpoint"`
+	ConnectionString string `json:"connectionString"`
+	SASToken         string `json:"sasToken,omitempty"`
+	SASURL           string `json:"sasUrl,omitempty"`
+}
+
+// SASOptions configures a SAS token signed with the account key. Without a
+// container the SAS is scoped to the blob service of the whole account.
+// Permissions use the SAS permission letters, e.g. "rl" for read and list.
+type SASOptions struct {
+	Container     string
+	Permissions   string
+	ResourceTypes string
+	Start         time.Time
+	Expiry        time.Time
+}
+
+// GetStorageCredentials retrieves the named account key of the storage account
+// and builds a connection string from it. When sasOptions is given a SAS token
+// is signed offline with the same key.
+func GetStorageCredentials(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+	keyName string,
+	sasOptions *SASOptions,
+) (*StorageCredentials, error) {
+	accountsClient, err := session.CreateStorageAccountsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage accounts client from session: %w", err)
+	}
+
+	accountResponse, err := accountsClient.GetProperties(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get storage account %s: %w", *blobConfig.Name, err)
+	}
+
+	properties := accountResponse.Account.Properties
+	if properties == nil || properties.PrimaryEndpoints == nil || properties.PrimaryEndpoints.Blob == nil {
+		return nil, fmt.Errorf("storage account %s has no blob endpoint", *blobConfig.Name)
+	}
+
+	if properties.AllowSharedKeyAccess != nil && !*properties.AllowSharedKeyAccess {
+		log.Printf("warning: storage account %s does not allow shared key access, the account key and SAS cannot be used to authorize requests", *blobConfig.Name)
+	}
+
+	accountKeys, err := GetAccountKeys(ctx, blobConfig, session)
+	if err != nil {
+		return nil, err
+	}
+
+	var accountKey string
+	for _, key := range accountKeys {
+		if key.KeyName != nil && *key.KeyName == keyName && key.Value != nil {
+			accountKey = *key.Value
+		}
+	}
+	if accountKey == "" {
+		return nil, fmt.Errorf("could not find key %s for storage account %s", keyName, *blobConfig.Name)
+	}
+
+	blobEndpoint := *properties.PrimaryEndpoints.Blob
+	connectionString, err := BuildConnectionString(*blobConfig.Name, accountKey, blobEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := &StorageCredentials{
+		AccountName:      *blobConfig.Name,
+		AccountKey:       accountKey,
+		BlobEndpoint:     blobEndpoint,
+		ConnectionString: connectionString,
+	}
+
+	if sasOptions == nil {
+		return credentials, nil
+	}
+
+	if sasOptions.Container != "" {
+		credentials.SASToken, err = GenerateContainerSAS(*blobConfig.Name, accountKey, sasOptions)
+	} else {
+		credentials.SASToken, err = GenerateAccountSAS(*blobConfig.Name, accountKey, sasOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sasURL := strings.TrimSuffix(blobEndpoint, "/") + "/"
+	if sasOptions.Container != "" {
+		sasURL += sasOptions.Container
+	}
+	credentials.SASURL = sasURL + "?" + credentials.SASToken
+
+	return credentials, nil
+}
+
+// GetAccountKeys lists the access keys of the storage account.
+func GetAccountKeys(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+) ([]*armstorage.AccountKey, error) {
+	accountsClient, err := session.CreateStorageAccountsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage accounts client from session: %w", err)
+	}
+
+	keysResponse, err := accountsClient.ListKeys(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ListKeys for storage account %s: %w", *blobConfig.Name, err)
+	}
+
+	return keysResponse.Keys, nil
+}
+
+// BuildConnectionString builds a storage connection string for the account.
+// The endpoint suffix is taken from the blob endpoint so connection strings
+// for sovereign and custom clouds point at the right hosts.
+func BuildConnectionString(accountName string, accountKey string, blobEndpoint string) (string, error) {
+	endpointURL, err := url.Parse(blobEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("could not parse blob endpoint %s: %w", blobEndpoint, err)
+	}
+
+	endpointSuffix, found := strings.CutPrefix(endpointURL.Hostname(), accountName+".blob.")
+	if !found {
+		return "", fmt.Errorf("blob endpoint %s does not belong to storage account %s", blobEndpoint, accountName)
+	}
+
+	return fmt.Sprintf("DefaultEndpointsProtocol=https;AccountName=%s;AccountKey=%s;EndpointSuffix=%s",
+		accountName, accountKey, endpointSuffix), nil
+}
+
+// GenerateAccountSAS signs an account SAS for the blob service. Resource
+// types default to service, container and object.
+func GenerateAccountSAS(accountName string, accountKey string, options *SASOptions) (string, error) {
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return "", fmt.Errorf("could not create shared key credential: %w", err)
+	}
+
+	resourceTypes := options.ResourceTypes
+	if resourceTypes == "" {
+		resourceTypes = "sco"
+	}
+
+	queryParameters, err := sas.AccountSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     options.Start.UTC(),
+		ExpiryTime:    options.Expiry.UTC(),
+		Permissions:   options.Permissions,
+		ResourceTypes: resourceTypes,
+	}.SignWithSharedKey(credential)
+	if err != nil {
+		return "", fmt.Errorf("could not sign account SAS: %w", err)
+	}
+
+	return queryParameters.Encode(), nil
+}
+
+// GenerateContainerSAS signs a service SAS scoped to a single container.
+func GenerateContainerSAS(accountName string, accountKey string, options *SASOptions) (string, error) {
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return "", fmt.Errorf("could not create shared key credential: %w", err)
+	}
+
+	queryParameters, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     options.Start.UTC(),
+		ExpiryTime:    options.Expiry.UTC(),
+		Permissions:   options.Permissions,
+		ContainerName: options.Container,
+	}.SignWithSharedKey(credential)
+	if err != nil {
+		return "", fmt.Errorf("could not sign SAS for container %s: %w", options.Container, err)
+	}
+
+	return queryParameters.Encode(), nil
+}
+
+type kubernetesSecret struct {
+	APIVersion string                   `yaml:"apiVersion"`
+	Kind       string                   `yaml:"kind"`
+	Metadata   kubernetesSecretMetadata `yaml:"metadata"`
+	Type       string                   `yaml:"type"`
+	StringData map[string]string        `yaml:"stringData"`
+}
+
+type kubernetesSecretMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// KubernetesSecretManifest renders the credentials as a Kubernetes Secret
+// manifest that can be applied with kubectl.
+func (credentials *StorageCredentials) KubernetesSecretManifest(name string, namespace string) ([]byte, error) {
+	stringData := map[string]string{
+		"accountName":      credentials.AccountName,
+		"accountKey":       credentials.AccountKey,
+		"blobEndpoint":     credentials.BlobEndpoint,
+		"connectionString": credentials.ConnectionString,
+	}
+
+	if credentials.SASToken != "" {
+		stringData["sasToken"] = credentials.SASToken
+		stringData["sasUrl"] = credentials.SASURL
+	}
+
+	manifest, err := yaml.Marshal(kubernetesSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: kubernetesSecretMetadata{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Type:       "Opaque",
+		StringData: stringData,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not YAML marshal kubernetes secret: %w", err)
+	}
+
+	return manifest, nil
+}
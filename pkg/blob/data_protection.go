@@ -0,0 +1,175 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// ConfigureDataProtection applies the versioning, soft delete, change feed and
+// point-in-time restore settings of the blob config to the account's blob
+// service. Settings left out of the DataProtection section are turned off, and
+// the blob service is left untouched when there is no such section.
+func ConfigureDataProtection(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+) error {
+	dataProtection := blobConfig.DataProtection
+	if dataProtection == nil {
+		return nil
+	}
+
+	blobServicesClient, err := session.CreateBlobServicesClient()
+	if err != nil {
+		return fmt.Errorf("could not create blob services client from session: %w", err)
+	}
+
+	properties := &armstorage.BlobServicePropertiesProperties{
+		IsVersioningEnabled:            to.Ptr(dataProtection.GetEnableVersioning()),
+		DeleteRetentionPolicy:          deleteRetentionPolicy(dataProtection.BlobSoftDeleteDays),
+		ContainerDeleteRetentionPolicy: deleteRetentionPolicy(dataProtection.ContainerSoftDeleteDays),
+		ChangeFeed: &armstorage.ChangeFeed{
+			Enabled:         to.Ptr(dataProtection.GetEnableChangeFeed()),
+			RetentionInDays: dataProtection.ChangeFeedRetentionDays,
+		},
+		RestorePolicy: &armstorage.RestorePolicyProperties{
+			Enabled: to.Ptr(dataProtection.PointInTimeRestoreDays != nil),
+			Days:    dataProtection.PointInTimeRestoreDays,
+		},
+	}
+
+	_, err = blobServicesClient.SetServiceProperties(
+		ctx,
+		*blobConfig.ResourceGroup,
+		*blobConfig.Name,
+		armstorage.BlobServiceProperties{BlobServiceProperties: properties},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run SetServiceProperties for storage account %s: %w", *blobConfig.Name, err)
+	}
+
+	log.Println("configured data protection for blob storage account:", *blobConfig.Name)
+
+	return nil
+}
+
+func deleteRetentionPolicy(days *int32) *armstorage.DeleteRetentionPolicy {
+	return &armstorage.DeleteRetentionPolicy{
+		Enabled: to.Ptr(days != nil),
+		Days:    days,
+	}
+}
+
+// ConfigureLifecyclePolicy replaces the lifecycle management policy of the
+// account with the rules in the blob config. The existing policy is left
+// untouched when there is no LifecyclePolicy section.
+func ConfigureLifecyclePolicy(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+) error {
+	if blobConfig.LifecyclePolicy == nil {
+		return nil
+	}
+
+	managementPoliciesClient, err := session.CreateManagementPoliciesClient()
+	if err != nil {
+		return fmt.Errorf("could not create management policies client from session: %w", err)
+	}
+
+	var rules []*armstorage.ManagementPolicyRule
+	for _, rule := range blobConfig.LifecyclePolicy.Rules {
+		rules = append(rules, lifecycleRule(rule))
+	}
+
+	_, err = managementPoliciesClient.CreateOrUpdate(
+		ctx,
+		*blobConfig.ResourceGroup,
+		*blobConfig.Name,
+		armstorage.ManagementPolicyNameDefault,
+		armstorage.ManagementPolicy{
+			Properties: &armstorage.ManagementPolicyProperties{
+				Policy: &armstorage.ManagementPolicySchema{
+					Rules: rules,
+				},
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for lifecycle policy of storage account %s: %w", *blobConfig.Name, err)
+	}
+
+	log.Println("configured lifecycle policy for blob storage account:", *blobConfig.Name)
+
+	return nil
+}
+
+// lifecycleRule converts a lifecycle rule config into a management policy
+// rule.
+func lifecycleRule(rule *config.StorageLifecycleRuleConfig) *armstorage.ManagementPolicyRule {
+	filters := &armstorage.ManagementPolicyFilter{}
+	for _, blobType := range rule.GetBlobTypes() {
+		filters.BlobTypes = append(filters.BlobTypes, to.Ptr(blobType))
+	}
+	for _, prefix := range rule.PrefixFilters {
+		filters.PrefixMatch = append(filters.PrefixMatch, to.Ptr(prefix))
+	}
+
+	actions := &armstorage.ManagementPolicyAction{}
+	if rule.TierToCoolAfterDays != nil || rule.TierToArchiveAfterDays != nil || rule.DeleteAfterDays != nil {
+		actions.BaseBlob = &armstorage.ManagementPolicyBaseBlob{
+			TierToCool:    daysAfterModification(rule.TierToCoolAfterDays),
+			TierToArchive: daysAfterModification(rule.TierToArchiveAfterDays),
+			Delete:        daysAfterModification(rule.DeleteAfterDays),
+		}
+	}
+
+	if rule.DeleteVersionsAfterDays != nil {
+		actions.Version = &armstorage.ManagementPolicyVersion{
+			Delete: daysAfterCreation(rule.DeleteVersionsAfterDays),
+		}
+	}
+
+	if rule.DeleteSnapshotsAfterDays != nil {
+		actions.Snapshot = &armstorage.ManagementPolicySnapShot{
+			Delete: daysAfterCreation(rule.DeleteSnapshotsAfterDays),
+		}
+	}
+
+	return &armstorage.ManagementPolicyRule{
+		Name:    rule.Name,
+		Enabled: to.Ptr(rule.GetEnabled()),
+		Type:    to.Ptr(armstorage.RuleTypeLifecycle),
+		Definition: &armstorage.ManagementPolicyDefinition{
+			Filters: filters,
+			Actions: actions,
+		},
+	}
+}
+
+func daysAfterModification(days *int32) *armstorage.DateAfterModification {
+	if days == nil {
+		return nil
+	}
+
+	return &armstorage.DateAfterModification{
+		DaysAfterModificationGreaterThan: to.Ptr(float32(*days)),
+	}
+}
+
+func daysAfterCreation(days *int32) *armstorage.DateAfterCreation {
+	if days == nil {
+		return nil
+	}
+
+	return &armstorage.DateAfterCreation{
+		DaysAfterCreationGreaterThan: to.Ptr(float32(*days)),
+	}
+}
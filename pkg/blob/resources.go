@@ -0,0 +1,240 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+// BlobStore is the output of a blob stack: the storage account and the
+// containers, queues and file shares declared in the blob config.
+type BlobStore struct {
+	Account    *armstorage.Account         `json:"account"`
+	Containers []*armstorage.BlobContainer `json:"containers,omitempty"`
+	Queues     []*armstorage.Queue         `json:"queues,omitempty"`
+	FileShares []*armstorage.FileShare     `json:"fileShares,omitempty"`
+}
+
+// ReconcileBlobResources creates the containers, queues and file shares in the
+// blob config that do not exist yet and updates the ones that do. Resources
+// that exist in the account but are missing from the config are left alone.
+func ReconcileBlobResources(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+	blobStore *BlobStore,
+) error {
+	for _, containerConfig := range blobConfig.Containers {
+		container, err := reconcileContainer(ctx, blobConfig, containerConfig, session)
+		if err != nil {
+			return fmt.Errorf("could not reconcile container %s: %w", *containerConfig.Name, err)
+		}
+		log.Println("reconciled blob container id:", *container.ID)
+		blobStore.Containers = append(blobStore.Containers, container)
+	}
+
+	for _, queueConfig := range blobConfig.Queues {
+		queue, err := reconcileQueue(ctx, blobConfig, queueConfig, session)
+		if err != nil {
+			return fmt.Errorf("could not reconcile queue %s: %w", *queueConfig.Name, err)
+		}
+		log.Println("reconciled queue id:", *queue.ID)
+		blobStore.Queues = append(blobStore.Queues, queue)
+	}
+
+	for _, fileShareConfig := range blobConfig.FileShares {
+		fileShare, err := reconcileFileShare(ctx, blobConfig, fileShareConfig, session)
+		if err != nil {
+			return fmt.Errorf("could not reconcile file share %s: %w", *fileShareConfig.Name, err)
+		}
+		log.Println("reconciled file share id:", *fileShare.ID)
+		blobStore.FileShares = append(blobStore.FileShares, fileShare)
+	}
+
+	return nil
+}
+
+func reconcileContainer(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	containerConfig *config.StorageContainerConfig,
+	session *config.AzureSession,
+) (*armstorage.BlobContainer, error) {
+	blobContainersClient, err := session.CreateBlobContainersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create blob containers client from session: %w", err)
+	}
+
+	container := armstorage.BlobContainer{
+		ContainerProperties: &armstorage.ContainerProperties{
+			PublicAccess: to.Ptr(armstorage.PublicAccess(containerConfig.GetPublicAccess())),
+			Metadata:     toPtrMap(containerConfig.Metadata),
+		},
+	}
+
+	_, err = blobContainersClient.Get(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *containerConfig.Name, nil)
+	if err == nil {
+		resp, err := blobContainersClient.Update(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *containerConfig.Name, container, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run Update: %w", err)
+		}
+		return &resp.BlobContainer, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, fmt.Errorf("could not check for existing container: %w", err)
+	}
+
+	resp, err := blobContainersClient.Create(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *containerConfig.Name, container, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Create: %w", err)
+	}
+
+	return &resp.BlobContainer, nil
+}
+
+func reconcileQueue(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	queueConfig *config.StorageQueueConfig,
+	session *config.AzureSession,
+) (*armstorage.Queue, error) {
+	queueClient, err := session.CreateQueueClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create queue client from session: %w", err)
+	}
+
+	queue := armstorage.Queue{
+		QueueProperties: &armstorage.QueueProperties{
+			Metadata: toPtrMap(queueConfig.Metadata),
+		},
+	}
+
+	_, err = queueClient.Get(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *queueConfig.Name, nil)
+	if err == nil {
+		resp, err := queueClient.Update(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *queueConfig.Name, queue, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run Update: %w", err)
+		}
+		return &resp.Queue, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, fmt.Errorf("could not check for existing queue: %w", err)
+	}
+
+	resp, err := queueClient.Create(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *queueConfig.Name, queue, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Create: %w", err)
+	}
+
+	return &resp.Queue, nil
+}
+
+func reconcileFileShare(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	fileShareConfig *config.StorageFileShareConfig,
+	session *config.AzureSession,
+) (*armstorage.FileShare, error) {
+	fileSharesClient, err := session.CreateFileSharesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create file shares client from session: %w", err)
+	}
+
+	fileShare := armstorage.FileShare{
+		FileShareProperties: &armstorage.FileShareProperties{
+			ShareQuota: fileShareConfig.QuotaGiB,
+			Metadata:   toPtrMap(fileShareConfig.Metadata),
+		},
+	}
+
+	if fileShareConfig.AccessTier != nil {
+		fileShare.FileShareProperties.AccessTier = to.Ptr(armstorage.ShareAccessTier(*fileShareConfig.AccessTier))
+	}
+
+	_, err = fileSharesClient.Get(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *fileShareConfig.Name, nil)
+	if err == nil {
+		resp, err := fileSharesClient.Update(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *fileShareConfig.Name, fileShare, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run Update: %w", err)
+		}
+		return &resp.FileShare, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, fmt.Errorf("could not check for existing file share: %w", err)
+	}
+
+	resp, err := fileSharesClient.Create(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *fileShareConfig.Name, fileShare, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Create: %w", err)
+	}
+
+	return &resp.FileShare, nil
+}
+
+// getBlobResources looks up the containers, queues and file shares declared in
+// the blob config.
+func getBlobResources(
+	ctx context.Context,
+	blobConfig *config.AzureBlobConfig,
+	session *config.AzureSession,
+	blobStore *BlobStore,
+) error {
+	blobContainersClient, err := session.CreateBlobContainersClient()
+	if err != nil {
+		return fmt.Errorf("could not create blob containers client from session: %w", err)
+	}
+
+	for _, containerConfig := range blobConfig.Containers {
+		resp, err := blobContainersClient.Get(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *containerConfig.Name, nil)
+		if err != nil {
+			return fmt.Errorf("could not get container %s: %w", *containerConfig.Name, err)
+		}
+		blobStore.Containers = append(blobStore.Containers, &resp.BlobContainer)
+	}
+
+	queueClient, err := session.CreateQueueClient()
+	if err != nil {
+		return fmt.Errorf("could not create queue client from session: %w", err)
+	}
+
+	for _, queueConfig := range blobConfig.Queues {
+		resp, err := queueClient.Get(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *queueConfig.Name, nil)
+		if err != nil {
+			return fmt.Errorf("could not get queue %s: %w", *queueConfig.Name, err)
+		}
+		blobStore.Queues = append(blobStore.Queues, &resp.Queue)
+	}
+
+	fileSharesClient, err := session.CreateFileSharesClient()
+	if err != nil {
+		return fmt.Errorf("could not create file shares client from session: %w", err)
+	}
+
+	for _, fileShareConfig := range blobConfig.FileShares {
+		resp, err := fileSharesClient.Get(ctx, *blobConfig.ResourceGroup, *blobConfig.Name, *fileShareConfig.Name, nil)
+		if err != nil {
+			return fmt.Errorf("could not get file share %s: %w", *fileShareConfig.Name, err)
+		}
+		blobStore.FileShares = append(blobStore.FileShares, &resp.FileShare)
+	}
+
+	return nil
+}
+
+func toPtrMap(values map[string]string) map[string]*string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	ptrMap := make(map[string]*string, len(values))
+	for key, value := range values {
+		ptrMap[key] = to.Ptr(value)
+	}
+
+	return ptrMap
+}
@@ -0,0 +1,18 @@
+package config
+
+import "os"
+
+// administratorPassword returns the configured password of a database server
+// administrator, falling back to the given environment variable. It returns
+// false when the password is set in neither.
+func administratorPassword(password *string, envVar string) (string, bool) {
+	if password != nil && *password != "" {
+		return *password, true
+	}
+
+	if envPassword := os.Getenv(envVar); envPassword != "" {
+		return envPassword, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,369 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// Supported values for the mode, priority, eviction policy, OS disk type and
+// OS SKU of an AKS node pool.
+const (
+	AksNodePoolModeSystem = "System"
+	AksNodePoolModeUser   = "User"
+
+	AksNodePoolPriorityRegular = "Regular"
+	AksNodePoolPrioritySpot    = "Spot"
+
+	AksEvictionPolicyDelete     = "Delete"
+	AksEvictionPolicyDeallocate = "Deallocate"
+
+	AksOSDiskTypeManaged   = "Managed"
+	AksOSDiskTypeEphemeral = "Ephemeral"
+
+	AksOSSKUUbuntu     = "Ubuntu"
+	AksOSSKUAzureLinux = "AzureLinux"
+)
+
+// Defaults used for any node pool setting left out of the aks config.
+const (
+	DefaultAksVMSize    = "Standard_DS2_v2"
+	DefaultAksNodeCount = 1
+	DefaultAksMinCount  = 1
+	DefaultAksMaxCount  = 100
+	DefaultAksMaxPods   = 110
+
+	// DefaultAksAgentPoolName is the name of the system pool created from the
+	// AgentPool section when no NodePools are listed.
+	DefaultAksAgentPoolName = "askagent"
+
+	// DefaultAksSpotMaxPrice caps spot nodes at the on-demand price.
+	DefaultAksSpotMaxPrice = -1
+)
+
+var aksNodePoolNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9]{0,11}$`)
+
+// AzureAksConfig is the config used to create an AKS cluster.
+type AzureAksConfig struct {
+	AzureResourceConfig `yaml:",inline"`
+	AgentPool           *AksNodePoolConfig   `yaml:"AgentPool"`
+	NodePools           []*AksNodePoolConfig `yaml:"NodePools"`
+}
+
+// AksNodePoolConfig describes the virtual machines backing an AKS node pool.
+type AksNodePoolConfig struct {
+	Name              *string           `yaml:"Name"`
+	Mode              *string           `yaml:"Mode"`
+	Priority          *string           `yaml:"Priority"`
+	EvictionPolicy    *string           `yaml:"EvictionPolicy"`
+	SpotMaxPrice      *float32          `yaml:"SpotMaxPrice"`
+	VMSize            *string           `yaml:"VMSize"`
+	NodeCount         *int32            `yaml:"NodeCount"`
+	EnableAutoScaling *bool             `yaml:"EnableAutoScaling"`
+	MinCount          *int32            `yaml:"MinCount"`
+	MaxCount          *int32            `yaml:"MaxCount"`
+	MaxPods           *int32            `yaml:"MaxPods"`
+	OSDiskSizeGB      *int32            `yaml:"OSDiskSizeGB"`
+	OSDiskType        *string           `yaml:"OSDiskType"`
+	OSSKU             *string           `yaml:"OSSKU"`
+	AvailabilityZones []string          `yaml:"AvailabilityZones"`
+	NodeLabels        map[string]string `yaml:"NodeLabels"`
+	NodeTaints        []string          `yaml:"NodeTaints"`
+}
+
+func (config *AzureAksConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if config.AgentPool != nil && len(config.NodePools) > 0 {
+		return fmt.Errorf("AgentPool and NodePools cannot both be set")
+	}
+
+	hasSystemPool := false
+	poolNames := make(map[string]bool)
+	for _, pool := range config.GetNodePools() {
+		if pool.Name == nil {
+			return fmt.Errorf("could not find Name for node pool")
+		}
+
+		if poolNames[*pool.Name] {
+			return fmt.Errorf("node pool name %s is used more than once", *pool.Name)
+		}
+		poolNames[*pool.Name] = true
+
+		if err := pool.Validate(); err != nil {
+			return fmt.Errorf("could not validate node pool %s: %w", *pool.Name, err)
+		}
+
+		if pool.GetMode() == AksNodePoolModeSystem {
+			hasSystemPool = true
+		}
+	}
+
+	if !hasSystemPool {
+		return fmt.Errorf("at least one node pool must have mode %s", AksNodePoolModeSystem)
+	}
+
+	return nil
+}
+
+// GetNodePools returns the node pools for the cluster. When no NodePools are
+// listed, the AgentPool section (or its defaults) becomes the single system
+// pool.
+func (config *AzureAksConfig) GetNodePools() []*AksNodePoolConfig {
+	if len(config.NodePools) > 0 {
+		return config.NodePools
+	}
+
+	agentPool := AksNodePoolConfig{}
+	if config.AgentPool != nil {
+		agentPool = *config.AgentPool
+	}
+
+	if agentPool.Name == nil {
+		agentPool.Name = to.Ptr(DefaultAksAgentPoolName)
+	}
+
+	if agentPool.Mode == nil {
+		agentPool.Mode = to.Ptr(AksNodePoolModeSystem)
+	}
+
+	return []*AksNodePoolConfig{&agentPool}
+}
+
+// GetInitialSystemPool returns the first system pool, which is the only pool
+// sent with the cluster create request. Every other pool is created through
+// the agent pools API once the cluster exists.
+func (config *AzureAksConfig) GetInitialSystemPool() *AksNodePoolConfig {
+	for _, pool := range config.GetNodePools() {
+		if pool.GetMode() == AksNodePoolModeSystem {
+			return pool
+		}
+	}
+
+	return nil
+}
+
+func (pool *AksNodePoolConfig) GetMode() string {
+	if pool.Mode == nil {
+		return AksNodePoolModeUser
+	}
+
+	return *pool.Mode
+}
+
+func (pool *AksNodePoolConfig) GetPriority() string {
+	if pool.Priority == nil {
+		return AksNodePoolPriorityRegular
+	}
+
+	return *pool.Priority
+}
+
+func (pool *AksNodePoolConfig) GetEvictionPolicy() string {
+	if pool.EvictionPolicy == nil {
+		return AksEvictionPolicyDelete
+	}
+
+	return *pool.EvictionPolicy
+}
+
+func (pool *AksNodePoolConfig) GetSpotMaxPrice() float32 {
+	if pool.SpotMaxPrice == nil {
+		return DefaultAksSpotMaxPrice
+	}
+
+	return *pool.SpotMaxPrice
+}
+
+func (pool *AksNodePoolConfig) GetVMSize() string {
+	if pool.VMSize == nil {
+		return DefaultAksVMSize
+	}
+
+	return *pool.VMSize
+}
+
+func (pool *AksNodePoolConfig) GetNodeCount() int32 {
+	if pool.NodeCount == nil {
+		return DefaultAksNodeCount
+	}
+
+	return *pool.NodeCount
+}
+
+func (pool *AksNodePoolConfig) GetEnableAutoScaling() bool {
+	if pool.EnableAutoScaling == nil {
+		return true
+	}
+
+	return *pool.EnableAutoScaling
+}
+
+func (pool *AksNodePoolConfig) GetMinCount() int32 {
+	if pool.MinCount == nil {
+		return DefaultAksMinCount
+	}
+
+	return *pool.MinCount
+}
+
+func (pool *AksNodePoolConfig) GetMaxCount() int32 {
+	if pool.MaxCount == nil {
+		return DefaultAksMaxCount
+	}
+
+	return *pool.MaxCount
+}
+
+func (pool *AksNodePoolConfig) GetMaxPods() int32 {
+	if pool.MaxPods == nil {
+		return DefaultAksMaxPods
+	}
+
+	return *pool.MaxPods
+}
+
+func (pool *AksNodePoolConfig) Validate() error {
+	if pool.Name != nil && !aksNodePoolNameRegexp.MatchString(*pool.Name) {
+		return fmt.Errorf("node pool name %s must start with a lowercase letter and contain at most 12 lowercase letters and numbers", *pool.Name)
+	}
+
+	switch pool.GetMode() {
+	case AksNodePoolModeSystem, AksNodePoolModeUser:
+	default:
+		return fmt.Errorf("unsupported Mode %s, must be one of %s or %s",
+			pool.GetMode(), AksNodePoolModeSystem, AksNodePoolModeUser)
+	}
+
+	if pool.GetMode() == AksNodePoolModeSystem && pool.GetNodeCount() < 1 {
+		return fmt.Errorf("system node pools need at least 1 node, got %d", pool.GetNodeCount())
+	}
+
+	switch pool.GetPriority() {
+	case AksNodePoolPriorityRegular:
+		if pool.EvictionPolicy != nil || pool.SpotMaxPrice != nil {
+			return fmt.Errorf("EvictionPolicy and SpotMaxPrice can only be set when Priority is %s", AksNodePoolPrioritySpot)
+		}
+	case AksNodePoolPrioritySpot:
+		if pool.GetMode() == AksNodePoolModeSystem {
+			return fmt.Errorf("system node pools cannot use %s priority", AksNodePoolPrioritySpot)
+		}
+
+		switch pool.GetEvictionPolicy() {
+		case AksEvictionPolicyDelete, AksEvictionPolicyDeallocate:
+		default:
+			return fmt.Errorf("unsupported EvictionPolicy %s, must be one of %s or %s",
+				pool.GetEvictionPolicy(), AksEvictionPolicyDelete, AksEvictionPolicyDeallocate)
+		}
+
+		if pool.GetSpotMaxPrice() != DefaultAksSpotMaxPrice && pool.GetSpotMaxPrice() <= 0 {
+			return fmt.Errorf("SpotMaxPrice must be -1 or greater than 0, got %v", pool.GetSpotMaxPrice())
+		}
+	default:
+		return fmt.Errorf("unsupported Priority %s, must be one of %s or %s",
+			pool.GetPriority(), AksNodePoolPriorityRegular, AksNodePoolPrioritySpot)
+	}
+
+	if pool.VMSize != nil && *pool.VMSize == "" {
+		return fmt.Errorf("VMSize cannot be empty")
+	}
+
+	if pool.GetNodeCount() < 0 || pool.GetNodeCount() > 1000 {
+		return fmt.Errorf("NodeCount must be between 0 and 1000, got %d", pool.GetNodeCount())
+	}
+
+	if pool.GetEnableAutoScaling() {
+		if pool.GetMinCount() < 0 {
+			return fmt.Errorf("MinCount cannot be negative, got %d", pool.GetMinCount())
+		}
+
+		if pool.GetMaxCount() > 1000 {
+			return fmt.Errorf("MaxCount cannot exceed 1000, got %d", pool.GetMaxCount())
+		}
+
+		if pool.GetMinCount() > pool.GetMaxCount() {
+			return fmt.Errorf("MinCount %d cannot exceed MaxCount %d", pool.GetMinCount(), pool.GetMaxCount())
+		}
+
+		if pool.GetNodeCount() < pool.GetMinCount() || pool.GetNodeCount() > pool.GetMaxCount() {
+			return fmt.Errorf("NodeCount %d must be between MinCount %d and MaxCount %d",
+				pool.GetNodeCount(), pool.GetMinCount(), pool.GetMaxCount())
+		}
+	} else if pool.MinCount != nil || pool.MaxCount != nil {
+		return fmt.Errorf("MinCount and MaxCount can only be set when autoscaling is enabled")
+	}
+
+	if pool.GetMaxPods() < 10 || pool.GetMaxPods() > 250 {
+		return fmt.Errorf("MaxPods must be between 10 and 250, got %d", pool.GetMaxPods())
+	}
+
+	if pool.OSDiskSizeGB != nil && (*pool.OSDiskSizeGB < 30 || *pool.OSDiskSizeGB > 2048) {
+		return fmt.Errorf("OSDiskSizeGB must be between 30 and 2048, got %d", *pool.OSDiskSizeGB)
+	}
+
+	if pool.OSDiskType != nil {
+		switch *pool.OSDiskType {
+		case AksOSDiskTypeManaged, AksOSDiskTypeEphemeral:
+		default:
+			return fmt.Errorf("unsupported OSDiskType %s, must be one of %s or %s",
+				*pool.OSDiskType, AksOSDiskTypeManaged, AksOSDiskTypeEphemeral)
+		}
+	}
+
+	if pool.OSSKU != nil {
+		switch *pool.OSSKU {
+		case AksOSSKUUbuntu, AksOSSKUAzureLinux:
+		default:
+			return fmt.Errorf("unsupported OSSKU %s, must be one of %s or %s",
+				*pool.OSSKU, AksOSSKUUbuntu, AksOSSKUAzureLinux)
+		}
+	}
+
+	for _, zone := range pool.AvailabilityZones {
+		switch zone {
+		case "1", "2", "3":
+		default:
+			return fmt.Errorf("unsupported availability zone %s, must be one of 1, 2 or 3", zone)
+		}
+	}
+
+	for key := range pool.NodeLabels {
+		if key == "" {
+			return fmt.Errorf("node label keys cannot be empty")
+		}
+	}
+
+	for _, taint := range pool.NodeTaints {
+		if err := validateNodeTaint(taint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateNodeTaint checks that a taint has the key=value:Effect form
+// expected by AKS.
+func validateNodeTaint(taint string) error {
+	keyValue, effect, found := strings.Cut(taint, ":")
+	if !found {
+		return fmt.Errorf("node taint %s must have the form key=value:Effect", taint)
+	}
+
+	key, _, _ := strings.Cut(keyValue, "=")
+	if key == "" {
+		return fmt.Errorf("node taint %s is missing a key", taint)
+	}
+
+	switch effect {
+	case "NoSchedule", "PreferNoSchedule", "NoExecute":
+	default:
+		return fmt.Errorf("node taint %s has unsupported effect %s", taint, effect)
+	}
+
+	return nil
+}
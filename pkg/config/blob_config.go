@@ -0,0 +1,330 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Supported values for the SKU, kind, access tier and minimum TLS version of a
+// storage account. The SKU sets both the performance tier and the redundancy.
+const (
+	StorageSKUStandardLRS    = "Standard_LRS"
+	StorageSKUStandardZRS    = "Standard_ZRS"
+	StorageSKUStandardGRS    = "Standard_GRS"
+	StorageSKUStandardRAGRS  = "Standard_RAGRS"
+	StorageSKUStandardGZRS   = "Standard_GZRS"
+	StorageSKUStandardRAGZRS = "Standard_RAGZRS"
+	StorageSKUPremiumLRS     = "Premium_LRS"
+	StorageSKUPremiumZRS     = "Premium_ZRS"
+
+	StorageKindStorageV2        = "StorageV2"
+	StorageKindBlockBlobStorage = "BlockBlobStorage"
+	StorageKindFileStorage      = "FileStorage"
+
+	StorageAccessTierHot  = "Hot"
+	StorageAccessTierCool = "Cool"
+
+	StorageMinimumTLSVersion10 = "TLS1_0"
+	StorageMinimumTLSVersion11 = "TLS1_1"
+	StorageMinimumTLSVersion12 = "TLS1_2"
+
+	StoragePublicAccessNone      = "None"
+	StoragePublicAccessBlob      = "Blob"
+	StoragePublicAccessContainer = "Container"
+
+	StorageShareAccessTierTransactionOptimized = "TransactionOptimized"
+	StorageShareAccessTierHot                  = "Hot"
+	StorageShareAccessTierCool                 = "Cool"
+	StorageShareAccessTierPremium              = "Premium"
+)
+
+var (
+	storageAccountNameRegexp = regexp.MustCompile(`^[a-z0-9]{3,24}$`)
+
+	// containers, queues and file shares share the same naming rules, the
+	// length is checked separately as a repeat can match two characters
+	storageChildNameRegexp = regexp.MustCompile(`^[a-z0-9](?:-?[a-z0-9])+$`)
+)
+
+// AzureBlobConfig is the config used to create a storage account for blob
+// storage.
+type AzureBlobConfig struct {
+	AzureResourceConfig         `yaml:",inline"`
+	SKU                         *string `yaml:"SKU"`
+	Kind                        *string `yaml:"Kind"`
+	AccessTier                  *string `yaml:"AccessTier"`
+	EnableHierarchicalNamespace *bool   `yaml:"EnableHierarchicalNamespace"`
+	MinimumTLSVersion           *string `yaml:"MinimumTLSVersion"`
+	AllowBlobPublicAccess       *bool   `yaml:"AllowBlobPublicAccess"`
+	AllowSharedKeyAccess        *bool   `yaml:"AllowSharedKeyAccess"`
+
+	Containers []*StorageContainerConfig `yaml:"Containers"`
+	Queues     []*StorageQueueConfig     `yaml:"Queues"`
+	FileShares []*StorageFileShareConfig `yaml:"FileShares"`
+
+	DataProtection  *StorageDataProtectionConfig  `yaml:"DataProtection"`
+	LifecyclePolicy *StorageLifecyclePolicyConfig `yaml:"LifecyclePolicy"`
+
+	CustomerManagedKey *CustomerManagedKeyConfig `yaml:"CustomerManagedKey"`
+}
+
+// StorageContainerConfig describes a blob container in the storage account.
+type StorageContainerConfig struct {
+	Name         *string           `yaml:"Name"`
+	PublicAccess *string           `yaml:"PublicAccess"`
+	Metadata     map[string]string `yaml:"Metadata"`
+}
+
+// StorageQueueConfig describes a queue in the storage account.
+type StorageQueueConfig struct {
+	Name     *string           `yaml:"Name"`
+	Metadata map[string]string `yaml:"Metadata"`
+}
+
+// StorageFileShareConfig describes an Azure Files share in the storage
+// account.
+type StorageFileShareConfig struct {
+	Name       *string           `yaml:"Name"`
+	QuotaGiB   *int32            `yaml:"QuotaGiB"`
+	AccessTier *string           `yaml:"AccessTier"`
+	Metadata   map[string]string `yaml:"Metadata"`
+}
+
+func (config *AzureBlobConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if !storageAccountNameRegexp.MatchString(*config.Name) {
+		return fmt.Errorf("storage account name %s must be 3 to 24 lowercase letters and numbers", *config.Name)
+	}
+
+	switch config.GetSKU() {
+	case StorageSKUStandardLRS,
+		StorageSKUStandardZRS,
+		StorageSKUStandardGRS,
+		StorageSKUStandardRAGRS,
+		StorageSKUStandardGZRS,
+		StorageSKUStandardRAGZRS,
+		StorageSKUPremiumLRS,
+		StorageSKUPremiumZRS:
+	default:
+		return fmt.Errorf("unsupported SKU %s", config.GetSKU())
+	}
+
+	switch config.GetKind() {
+	case StorageKindStorageV2:
+	case StorageKindBlockBlobStorage, StorageKindFileStorage:
+		if !config.IsPremium() {
+			return fmt.Errorf("kind %s requires a premium SKU, got %s", config.GetKind(), config.GetSKU())
+		}
+	default:
+		return fmt.Errorf("unsupported Kind %s, must be one of %s, %s or %s",
+			config.GetKind(), StorageKindStorageV2, StorageKindBlockBlobStorage, StorageKindFileStorage)
+	}
+
+	if config.AccessTier != nil {
+		if config.IsPremium() {
+			return fmt.Errorf("AccessTier cannot be set for premium SKU %s", config.GetSKU())
+		}
+
+		switch *config.AccessTier {
+		case StorageAccessTierHot, StorageAccessTierCool:
+		default:
+			return fmt.Errorf("unsupported AccessTier %s, must be one of %s or %s",
+				*config.AccessTier, StorageAccessTierHot, StorageAccessTierCool)
+		}
+	}
+
+	switch config.GetMinimumTLSVersion() {
+	case StorageMinimumTLSVersion10, StorageMinimumTLSVersion11, StorageMinimumTLSVersion12:
+	default:
+		return fmt.Errorf("unsupported MinimumTLSVersion %s", config.GetMinimumTLSVersion())
+	}
+
+	// premium accounts only hold the kind of data they are made for, premium
+	// file shares need a FileStorage account and no premium account has queues
+	switch {
+	case config.GetKind() == StorageKindBlockBlobStorage && (len(config.Queues) > 0 || len(config.FileShares) > 0):
+		return fmt.Errorf("kind %s does not support queues or file shares", StorageKindBlockBlobStorage)
+	case config.GetKind() == StorageKindStorageV2 && config.IsPremium() && (len(config.Queues) > 0 || len(config.FileShares) > 0):
+		return fmt.Errorf("premium SKU %s with kind %s does not support queues or file shares, use kind %s for premium file shares",
+			config.GetSKU(), StorageKindStorageV2, StorageKindFileStorage)
+	case config.GetKind() == StorageKindFileStorage && (len(config.Containers) > 0 || len(config.Queues) > 0):
+		return fmt.Errorf("kind %s does not support containers or queues", StorageKindFileStorage)
+	case config.GetKind() == StorageKindFileStorage && (config.DataProtection != nil || config.LifecyclePolicy != nil):
+		return fmt.Errorf("kind %s does not support blob DataProtection or a LifecyclePolicy", StorageKindFileStorage)
+	case config.GetKind() == StorageKindFileStorage && config.EnableHierarchicalNamespace != nil && *config.EnableHierarchicalNamespace:
+		return fmt.Errorf("kind %s does not support EnableHierarchicalNamespace", StorageKindFileStorage)
+	}
+
+	containerNames := make(map[string]bool)
+	for _, container := range config.Containers {
+		if err := validateStorageChildName("container", container.Name, containerNames); err != nil {
+			return err
+		}
+
+		if err := container.validate(config.GetAllowBlobPublicAccess()); err != nil {
+			return fmt.Errorf("could not validate container %s: %w", *container.Name, err)
+		}
+	}
+
+	queueNames := make(map[string]bool)
+	for _, queue := range config.Queues {
+		if err := validateStorageChildName("queue", queue.Name, queueNames); err != nil {
+			return err
+		}
+	}
+
+	if config.DataProtection != nil {
+		hierarchicalNamespace := config.EnableHierarchicalNamespace != nil && *config.EnableHierarchicalNamespace
+		if err := config.DataProtection.Validate(hierarchicalNamespace); err != nil {
+			return fmt.Errorf("could not validate data protection: %w", err)
+		}
+	}
+
+	if config.LifecyclePolicy != nil {
+		if err := config.LifecyclePolicy.Validate(config.GetSKU()); err != nil {
+			return fmt.Errorf("could not validate lifecycle policy: %w", err)
+		}
+	}
+
+	if config.CustomerManagedKey != nil {
+		if err := config.CustomerManagedKey.Validate(); err != nil {
+			return fmt.Errorf("could not validate customer managed key: %w", err)
+		}
+	}
+
+	fileShareNames := make(map[string]bool)
+	for _, fileShare := range config.FileShares {
+		if err := validateStorageChildName("file share", fileShare.Name, fileShareNames); err != nil {
+			return err
+		}
+
+		if err := fileShare.validate(config.IsPremium()); err != nil {
+			return fmt.Errorf("could not validate file share %s: %w", *fileShare.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateStorageChildName checks the name of a container, queue or file share
+// and that it is unique among its siblings.
+func validateStorageChildName(kind string, name *string, seen map[string]bool) error {
+	if name == nil {
+		return fmt.Errorf("could not find Name for %s", kind)
+	}
+
+	if !storageChildNameRegexp.MatchString(*name) || len(*name) < 3 || len(*name) > 63 {
+		return fmt.Errorf("%s name %s must be 3 to 63 lowercase letters, numbers and single hyphens", kind, *name)
+	}
+
+	if seen[*name] {
+		return fmt.Errorf("%s name %s is used more than once", kind, *name)
+	}
+	seen[*name] = true
+
+	return nil
+}
+
+func (container *StorageContainerConfig) GetPublicAccess() string {
+	if container.PublicAccess == nil {
+		return StoragePublicAccessNone
+	}
+
+	return *container.PublicAccess
+}
+
+func (container *StorageContainerConfig) validate(allowBlobPublicAccess bool) error {
+	switch container.GetPublicAccess() {
+	case StoragePublicAccessNone:
+	case StoragePublicAccessBlob, StoragePublicAccessContainer:
+		if !allowBlobPublicAccess {
+			return fmt.Errorf("PublicAccess %s requires AllowBlobPublicAccess on the storage account", container.GetPublicAccess())
+		}
+	default:
+		return fmt.Errorf("unsupported PublicAccess %s, must be one of %s, %s or %s",
+			container.GetPublicAccess(), StoragePublicAccessNone, StoragePublicAccessBlob, StoragePublicAccessContainer)
+	}
+
+	return nil
+}
+
+func (fileShare *StorageFileShareConfig) validate(premium bool) error {
+	if fileShare.QuotaGiB != nil && (*fileShare.QuotaGiB < 1 || *fileShare.QuotaGiB > 102400) {
+		return fmt.Errorf("QuotaGiB must be between 1 and 102400, got %d", *fileShare.QuotaGiB)
+	}
+
+	if fileShare.AccessTier == nil {
+		return nil
+	}
+
+	switch *fileShare.AccessTier {
+	case StorageShareAccessTierPremium:
+		if !premium {
+			return fmt.Errorf("AccessTier %s requires a premium SKU", StorageShareAccessTierPremium)
+		}
+	case StorageShareAccessTierTransactionOptimized, StorageShareAccessTierHot, StorageShareAccessTierCool:
+		if premium {
+			return fmt.Errorf("AccessTier %s is not available with a premium SKU", *fileShare.AccessTier)
+		}
+	default:
+		return fmt.Errorf("unsupported AccessTier %s", *fileShare.AccessTier)
+	}
+
+	return nil
+}
+
+func (config *AzureBlobConfig) GetSKU() string {
+	if config.SKU == nil {
+		return StorageSKUStandardLRS
+	}
+
+	return *config.SKU
+}
+
+func (config *AzureBlobConfig) GetKind() string {
+	if config.Kind == nil {
+		return StorageKindStorageV2
+	}
+
+	return *config.Kind
+}
+
+// GetAccessTier returns the default access tier for blobs in the account.
+// Premium accounts have no access tier, so an empty string is returned for
+// them.
+func (config *AzureBlobConfig) GetAccessTier() string {
+	if config.AccessTier != nil {
+		return *config.AccessTier
+	}
+
+	if config.IsPremium() {
+		return ""
+	}
+
+	return StorageAccessTierCool
+}
+
+func (config *AzureBlobConfig) GetMinimumTLSVersion() string {
+	if config.MinimumTLSVersion == nil {
+		return StorageMinimumTLSVersion12
+	}
+
+	return *config.MinimumTLSVersion
+}
+
+func (config *AzureBlobConfig) GetAllowBlobPublicAccess() bool {
+	if config.AllowBlobPublicAccess == nil {
+		return false
+	}
+
+	return *config.AllowBlobPublicAccess
+}
+
+// IsPremium returns true when the SKU uses premium performance.
+func (config *AzureBlobConfig) IsPremium() bool {
+	return strings.HasPrefix(config.GetSKU(), "Premium_")
+}
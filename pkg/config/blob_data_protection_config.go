@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Supported blob types for lifecycle management rule filters.
+const (
+	StorageBlobTypeBlockBlob  = "blockBlob"
+	StorageBlobTypeAppendBlob = "appendBlob"
+)
+
+var lifecycleRuleNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]{1,256}$`)
+
+// StorageDataProtectionConfig holds the data protection settings of the blob
+// service in a storage account. Retention periods are in days.
+type StorageDataProtectionConfig struct {
+	EnableVersioning        *bool  `yaml:"EnableVersioning"`
+	BlobSoftDeleteDays      *int32 `yaml:"BlobSoftDeleteDays"`
+	ContainerSoftDeleteDays *int32 `yaml:"ContainerSoftDeleteDays"`
+	EnableChangeFeed        *bool  `yaml:"EnableChangeFeed"`
+	ChangeFeedRetentionDays *int32 `yaml:"ChangeFeedRetentionDays"`
+	PointInTimeRestoreDays  *int32 `yaml:"PointInTimeRestoreDays"`
+}
+
+// StorageLifecyclePolicyConfig is the lifecycle management policy of a storage
+// account.
+type StorageLifecyclePolicyConfig struct {
+	Rules []*StorageLifecycleRuleConfig `yaml:"Rules"`
+}
+
+// StorageLifecycleRuleConfig is a single lifecycle management rule. Base blob
+// actions count days since the blob was last modified, version and snapshot
+// actions count days since they were created.
+type StorageLifecycleRuleConfig struct {
+	Name                     *string  `yaml:"Name"`
+	Enabled                  *bool    `yaml:"Enabled"`
+	PrefixFilters            []string `yaml:"PrefixFilters"`
+	BlobTypes                []string `yaml:"BlobTypes"`
+	TierToCoolAfterDays      *int32   `yaml:"TierToCoolAfterDays"`
+	TierToArchiveAfterDays   *int32   `yaml:"TierToArchiveAfterDays"`
+	DeleteAfterDays          *int32   `yaml:"DeleteAfterDays"`
+	DeleteVersionsAfterDays  *int32   `yaml:"DeleteVersionsAfterDays"`
+	DeleteSnapshotsAfterDays *int32   `yaml:"DeleteSnapshotsAfterDays"`
+}
+
+func (dataProtection *StorageDataProtectionConfig) Validate(hierarchicalNamespace bool) error {
+	if err := validateRetentionDays("BlobSoftDeleteDays", dataProtection.BlobSoftDeleteDays, 1, 365); err != nil {
+		return err
+	}
+
+	if err := validateRetentionDays("ContainerSoftDeleteDays", dataProtection.ContainerSoftDeleteDays, 1, 365); err != nil {
+		return err
+	}
+
+	if err := validateRetentionDays("ChangeFeedRetentionDays", dataProtection.ChangeFeedRetentionDays, 1, 146000); err != nil {
+		return err
+	}
+
+	if dataProtection.ChangeFeedRetentionDays != nil && !dataProtection.GetEnableChangeFeed() {
+		return fmt.Errorf("ChangeFeedRetentionDays requires EnableChangeFeed")
+	}
+
+	if hierarchicalNamespace && (dataProtection.GetEnableVersioning() ||
+		dataProtection.GetEnableChangeFeed() ||
+		dataProtection.PointInTimeRestoreDays != nil) {
+		return fmt.Errorf("versioning, change feed and point-in-time restore are not supported with a hierarchical namespace")
+	}
+
+	if dataProtection.PointInTimeRestoreDays == nil {
+		return nil
+	}
+
+	// point-in-time restore replays the change feed over versions and soft
+	// deleted blobs, so all three have to be on and outlast the restore window
+	if !dataProtection.GetEnableVersioning() || !dataProtection.GetEnableChangeFeed() || dataProtection.BlobSoftDeleteDays == nil {
+		return fmt.Errorf("PointInTimeRestoreDays requires EnableVersioning, EnableChangeFeed and BlobSoftDeleteDays")
+	}
+
+	if *dataProtection.PointInTimeRestoreDays < 1 || *dataProtection.PointInTimeRestoreDays >= *dataProtection.BlobSoftDeleteDays {
+		return fmt.Errorf("PointInTimeRestoreDays must be at least 1 and less than BlobSoftDeleteDays %d, got %d",
+			*dataProtection.BlobSoftDeleteDays, *dataProtection.PointInTimeRestoreDays)
+	}
+
+	if dataProtection.ChangeFeedRetentionDays != nil && *dataProtection.ChangeFeedRetentionDays <= *dataProtection.PointInTimeRestoreDays {
+		return fmt.Errorf("ChangeFeedRetentionDays must be greater than PointInTimeRestoreDays %d, got %d",
+			*dataProtection.PointInTimeRestoreDays, *dataProtection.ChangeFeedRetentionDays)
+	}
+
+	return nil
+}
+
+func (dataProtection *StorageDataProtectionConfig) GetEnableVersioning() bool {
+	return dataProtection.EnableVersioning != nil && *dataProtection.EnableVersioning
+}
+
+func (dataProtection *StorageDataProtectionConfig) GetEnableChangeFeed() bool {
+	return dataProtection.EnableChangeFeed != nil && *dataProtection.EnableChangeFeed
+}
+
+// Validate checks the lifecycle rules against the SKU of the storage account,
+// as blobs cannot be moved to the archive tier in zone redundant accounts.
+func (lifecyclePolicy *StorageLifecyclePolicyConfig) Validate(sku string) error {
+	if len(lifecyclePolicy.Rules) == 0 {
+		return fmt.Errorf("lifecycle policy needs at least one rule")
+	}
+
+	ruleNames := make(map[string]bool)
+	for _, rule := range lifecyclePolicy.Rules {
+		if rule.Name == nil {
+			return fmt.Errorf("could not find Name for lifecycle rule")
+		}
+
+		if !lifecycleRuleNameRegexp.MatchString(*rule.Name) {
+			return fmt.Errorf("lifecycle rule name %s must only contain letters and numbers", *rule.Name)
+		}
+
+		if ruleNames[*rule.Name] {
+			return fmt.Errorf("lifecycle rule name %s is used more than once", *rule.Name)
+		}
+		ruleNames[*rule.Name] = true
+
+		if err := rule.validate(sku); err != nil {
+			return fmt.Errorf("could not validate lifecycle rule %s: %w", *rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (rule *StorageLifecycleRuleConfig) GetEnabled() bool {
+	if rule.Enabled == nil {
+		return true
+	}
+
+	return *rule.Enabled
+}
+
+// GetBlobTypes returns the blob types the rule applies to, which defaults to
+// block blobs.
+func (rule *StorageLifecycleRuleConfig) GetBlobTypes() []string {
+	if len(rule.BlobTypes) == 0 {
+		return []string{StorageBlobTypeBlockBlob}
+	}
+
+	return rule.BlobTypes
+}
+
+func (rule *StorageLifecycleRuleConfig) validate(sku string) error {
+	for _, blobType := range rule.GetBlobTypes() {
+		switch blobType {
+		case StorageBlobTypeBlockBlob, StorageBlobTypeAppendBlob:
+		default:
+			return fmt.Errorf("unsupported blob type %s, must be one of %s or %s",
+				blobType, StorageBlobTypeBlockBlob, StorageBlobTypeAppendBlob)
+		}
+
+		// append blobs cannot change tier, they can only be deleted
+		if blobType == StorageBlobTypeAppendBlob && (rule.TierToCoolAfterDays != nil || rule.TierToArchiveAfterDays != nil) {
+			return fmt.Errorf("blob type %s only supports delete actions, not TierToCoolAfterDays or TierToArchiveAfterDays",
+				StorageBlobTypeAppendBlob)
+		}
+	}
+
+	switch sku {
+	case StorageSKUStandardZRS, StorageSKUStandardGZRS, StorageSKUStandardRAGZRS:
+		if rule.TierToArchiveAfterDays != nil {
+			return fmt.Errorf("TierToArchiveAfterDays is not supported with zone redundant SKU %s", sku)
+		}
+	}
+
+	days := map[string]*int32{
+		"TierToCoolAfterDays":      rule.TierToCoolAfterDays,
+		"TierToArchiveAfterDays":   rule.TierToArchiveAfterDays,
+		"DeleteAfterDays":          rule.DeleteAfterDays,
+		"DeleteVersionsAfterDays":  rule.DeleteVersionsAfterDays,
+		"DeleteSnapshotsAfterDays": rule.DeleteSnapshotsAfterDays,
+	}
+
+	hasAction := false
+	for name, value := range days {
+		if value == nil {
+			continue
+		}
+		hasAction = true
+
+		if *value < 0 {
+			return fmt.Errorf("%s cannot be negative, got %d", name, *value)
+		}
+	}
+
+	if !hasAction {
+		return fmt.Errorf("lifecycle rule needs at least one action")
+	}
+
+	// blobs have to move through the tiers in order before they are deleted
+	if rule.TierToCoolAfterDays != nil && rule.TierToArchiveAfterDays != nil &&
+		*rule.TierToCoolAfterDays >= *rule.TierToArchiveAfterDays {
+		return fmt.Errorf("TierToCoolAfterDays must be less than TierToArchiveAfterDays")
+	}
+
+	if rule.DeleteAfterDays != nil {
+		for name, tierDays := range map[string]*int32{
+			"TierToCoolAfterDays":    rule.TierToCoolAfterDays,
+			"TierToArchiveAfterDays": rule.TierToArchiveAfterDays,
+		} {
+			if tierDays != nil && *tierDays >= *rule.DeleteAfterDays {
+				return fmt.Errorf("%s must be less than DeleteAfterDays", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateRetentionDays(name string, days *int32, min int32, max int32) error {
+	if days != nil && (*days < min || *days > max) {
+		return fmt.Errorf("%s must be between %d and %d, got %d", name, min, max, *days)
+	}
+
+	return nil
+}
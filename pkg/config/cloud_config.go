@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+// Supported values for the cloud in the credentials config.
+const (
+	CloudAzurePublic     = "AzurePublic"
+	CloudAzureChina      = "AzureChina"
+	CloudAzureGovernment = "AzureGovernment"
+	CloudCustom          = "Custom"
+)
+
+// GetCloud returns the configured cloud name, defaulting to the public cloud.
+// Setting a resource manager endpoint without a cloud name implies a custom
+// cloud.
+func (config *AzureCredentialsConfig) GetCloud() string {
+	if config.Cloud == nil || *config.Cloud == "" {
+		if config.ResourceManagerEndpoint != nil {
+			return CloudCustom
+		}
+		return CloudAzurePublic
+	}
+
+	return *config.Cloud
+}
+
+// CloudConfiguration returns the endpoints used for both authentication and
+// ARM requests.
+func (config *AzureCredentialsConfig) CloudConfiguration() (cloud.Configuration, error) {
+	switch config.GetCloud() {
+	case CloudAzurePublic:
+		return cloud.AzurePublic, nil
+	case CloudAzureChina:
+		return cloud.AzureChina, nil
+	case CloudAzureGovernment:
+		return cloud.AzureGovernment, nil
+	case CloudCustom:
+		if config.ResourceManagerEndpoint == nil {
+			return cloud.Configuration{}, fmt.Errorf("could not find Resource Manager Endpoint in credentials config for custom cloud")
+		}
+
+		if config.ActiveDirectoryAuthorityHost == nil {
+			return cloud.Configuration{}, fmt.Errorf("could not find Active Directory Authority Host in credentials config for custom cloud")
+		}
+
+		// ARM accepts tokens issued for its own endpoint unless told otherwise
+		audience := *config.ResourceManagerEndpoint
+		if config.ResourceManagerAudience != nil {
+			audience = *config.ResourceManagerAudience
+		}
+
+		return cloud.Configuration{
+			ActiveDirectoryAuthorityHost: *config.ActiveDirectoryAuthorityHost,
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager: {
+					Audience: audience,
+					Endpoint: *config.ResourceManagerEndpoint,
+				},
+			},
+		}, nil
+	}
+
+	return cloud.Configuration{}, fmt.Errorf("unsupported cloud %s in credentials config", config.GetCloud())
+}
+
+// clientOptions returns the options shared by the credential and ARM clients
+// so that both target the same cloud.
+func (config *AzureCredentialsConfig) clientOptions() (azcore.ClientOptions, error) {
+	cloudConfig, err := config.CloudConfiguration()
+	if err != nil {
+		return azcore.ClientOptions{}, err
+	}
+
+	return azcore.ClientOptions{Cloud: cloudConfig}, nil
+}
+
+// armClientOptions returns the options used for every ARM client factory.
+func (config *AzureCredentialsConfig) armClientOptions() (*arm.ClientOptions, error) {
+	clientOptions, err := config.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return &arm.ClientOptions{ClientOptions: clientOptions}, nil
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const compositeDefaultMaxParallel = 4
+
+var (
+	compositeComponentNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+	// references to the outputs of other components are written as
+	// ${<component>.<output>}
+	compositeOutputReferenceRegexp = regexp.MustCompile(`\$\{([a-z0-9-]+)\.([A-Za-z0-9]+)\}`)
+)
+
+// AzureCompositeConfig is the config of a composite stack: several resource
+// stacks provisioned together. The ResourceGroup and Region are used by every
+// component that does not set its own, and the Name is the stack name that
+// owns the resource group of all of them.
+type AzureCompositeConfig struct {
+	AzureResourceConfig `yaml:",inline"`
+	MaxParallel         *int                        `yaml:"MaxParallel"`
+	Components          []*CompositeComponentConfig `yaml:"Components"`
+}
+
+// CompositeComponentConfig is one resource stack of a composite stack. Type
+// is the name of the resource stack and Config its config. A component is
+// provisioned after the components in DependsOn and after the components
+// whose outputs its config refers to with ${<component>.<output>}. The fields
+// that identify the resources of a component cannot refer to outputs, as the
+// component has to be found by them to be planned or deleted.
+type CompositeComponentConfig struct {
+	Name      *string                `yaml:"Name"`
+	Type      *string                `yaml:"Type"`
+	DependsOn []string               `yaml:"DependsOn"`
+	Config    map[string]interface{} `yaml:"Config"`
+}
+
+// CompositeOutputReference is a reference to an output of a component.
+type CompositeOutputReference struct {
+	Component string
+	Output    string
+}
+
+// compositeIdentifyingFields are the fields of a component config that name
+// its resources.
+var compositeIdentifyingFields = []string{"Name", "ServerName", "ResourceGroup", "Region", "StackName"}
+
+func (config *AzureCompositeConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if config.GetMaxParallel() < 1 {
+		return fmt.Errorf("MaxParallel must be at least 1, got %d", config.GetMaxParallel())
+	}
+
+	if len(config.Components) == 0 {
+		return fmt.Errorf("could not find any Components in composite config")
+	}
+
+	componentNames := make(map[string]bool)
+	for _, component := range config.Components {
+		if component.Name == nil {
+			return fmt.Errorf("could not find Name in component config")
+		}
+		if !compositeComponentNameRegexp.MatchString(*component.Name) {
+			return fmt.Errorf("component name %s must be lowercase letters, numbers and hyphens", *component.Name)
+		}
+		if componentNames[*component.Name] {
+			return fmt.Errorf("component %s is declared more than once", *component.Name)
+		}
+		componentNames[*component.Name] = true
+	}
+
+	for _, component := range config.Components {
+		if component.Type == nil {
+			return fmt.Errorf("could not find Type in component %s", *component.Name)
+		}
+
+		if component.Config == nil {
+			return fmt.Errorf("could not find Config in component %s", *component.Name)
+		}
+
+		for _, field := range compositeIdentifyingFields {
+			if value, ok := component.Config[field].(string); ok && compositeOutputReferenceRegexp.MatchString(value) {
+				return fmt.Errorf("%s of component %s identifies its resources and cannot refer to outputs", field, *component.Name)
+			}
+		}
+
+		for _, dependency := range component.GetDependencies() {
+			if dependency == *component.Name {
+				return fmt.Errorf("component %s cannot depend on itself", *component.Name)
+			}
+			if !componentNames[dependency] {
+				return fmt.Errorf("component %s depends on unknown component %s", *component.Name, dependency)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetMaxParallel returns how many components are provisioned at the same
+// time.
+func (config *AzureCompositeConfig) GetMaxParallel() int {
+	if config.MaxParallel == nil {
+		return compositeDefaultMaxParallel
+	}
+
+	return *config.MaxParallel
+}
+
+// GetDependencies returns the components this component depends on, both
+// those in DependsOn and those whose outputs its config refers to.
+func (component *CompositeComponentConfig) GetDependencies() []string {
+	var dependencies []string
+	seen := make(map[string]bool)
+	addDependency := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			dependencies = append(dependencies, name)
+		}
+	}
+
+	for _, dependency := range component.DependsOn {
+		addDependency(dependency)
+	}
+
+	for _, reference := range component.GetOutputReferences() {
+		addDependency(reference.Component)
+	}
+
+	return dependencies
+}
+
+// HasOutputReferences returns true when the config of the component refers to
+// the outputs of other components.
+func (component *CompositeComponentConfig) HasOutputReferences() bool {
+	return len(component.GetOutputReferences()) > 0
+}
+
+// GetOutputReferences returns the references to outputs of other components
+// in the config of the component.
+func (component *CompositeComponentConfig) GetOutputReferences() []CompositeOutputReference {
+	var references []CompositeOutputReference
+	mapComponentStrings(component.Config, func(value string) (string, error) {
+		for _, match := range compositeOutputReferenceRegexp.FindAllStringSubmatch(value, -1) {
+			references = append(references, CompositeOutputReference{Component: match[1], Output: match[2]})
+		}
+		return value, nil
+	})
+
+	return references
+}
+
+// ResolveOutputs returns a copy of the config of the component with the
+// references to outputs replaced by the outputs of the components they name.
+func (component *CompositeComponentConfig) ResolveOutputs(
+	outputs map[string]map[string]string,
+) (map[string]interface{}, error) {
+	resolved, err := mapComponentStrings(component.Config, func(value string) (string, error) {
+		var resolveErr error
+		value = compositeOutputReferenceRegexp.ReplaceAllStringFunc(value, func(reference string) string {
+			match := compositeOutputReferenceRegexp.FindStringSubmatch(reference)
+			output, ok := outputs[match[1]][match[2]]
+			if !ok {
+				resolveErr = fmt.Errorf("component %s has no output %s", match[1], match[2])
+				return reference
+			}
+			return output
+		})
+		return value, resolveErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve outputs in component %s: %w", *component.Name, err)
+	}
+
+	return resolved.(map[string]interface{}), nil
+}
+
+// mapComponentStrings returns a copy of a YAML value with mapFn applied to
+// every string in it.
+func mapComponentStrings(value interface{}, mapFn func(string) (string, error)) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case string:
+		return mapFn(typedValue)
+	case []interface{}:
+		mapped := make([]interface{}, len(typedValue))
+		for i, item := range typedValue {
+			mappedItem, err := mapComponentStrings(item, mapFn)
+			if err != nil {
+				return nil, err
+			}
+			mapped[i] = mappedItem
+		}
+		return mapped, nil
+	case map[interface{}]interface{}:
+		mapped := make(map[interface{}]interface{}, len(typedValue))
+		for key, item := range typedValue {
+			mappedItem, err := mapComponentStrings(item, mapFn)
+			if err != nil {
+				return nil, err
+			}
+			mapped[key] = mappedItem
+		}
+		return mapped, nil
+	case map[string]interface{}:
+		mapped := make(map[string]interface{}, len(typedValue))
+		for key, item := range typedValue {
+			mappedItem, err := mapComponentStrings(item, mapFn)
+			if err != nil {
+				return nil, err
+			}
+			mapped[key] = mappedItem
+		}
+		return mapped, nil
+	}
+
+	return value, nil
+}
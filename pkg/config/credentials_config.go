@@ -2,127 +2,272 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"os"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v2"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// Supported values for the credential type in the credentials config.
+const (
+	CredentialTypeClientSecret      = "clientSecret"
+	CredentialTypeClientCertificate = "clientCertificate"
+	CredentialTypeManagedIdentity   = "managedIdentity"
+	CredentialTypeWorkloadIdentity  = "workloadIdentity"
+	CredentialTypeAzureCLI          = "azureCli"
+	CredentialTypeEnvironment       = "environment"
+	CredentialTypeChain             = "chain"
 )
 
 type AzureCredentialsConfig struct {
-	ClientID       *string `json:"clientId"`
-	ClientSecret   *string `json:"clientSecret"`
-	SubscriptionID *string `json:"subscriptionId"`
+	Type                *string  `json:"type"`
+	ClientID            *string  `json:"clientId"`
+	ClientSecret        *string  `json:"clientSecret"`
+	SubscriptionID      *string  `json:"subscriptionId"`
+	TenantID            *string  `json:"tenant"`
+	CertificatePath     *string  `json:"certificatePath"`
+	CertificatePassword *string  `json:"certificatePassword"`
+	FederatedTokenFile  *string  `json:"federatedTokenFile"`
+	Chain               []string `json:"chain"`
+
+	Cloud                        *string `json:"cloud"`
+	ResourceManagerEndpoint      *string `json:"resourceManagerEndpoint"`
+	ResourceManagerAudience      *string `json:"resourceManagerAudience"`
+	ActiveDirectoryAuthorityHost *string `json:"activeDirectoryAuthorityHost"`
 }
 
-func (config *AzureCredentialsConfig) ValidateNotNull() error {
-	if config.ClientID == nil {
-		return fmt.Errorf("could not find Client ID in credentials config")
+// GetType returns the configured credential type, defaulting to a client
+// secret so that existing service principal files keep working.
+func (config *AzureCredentialsConfig) GetType() string {
+	if config.Type == nil || *config.Type == "" {
+		return CredentialTypeClientSecret
 	}
 
-	if config.ClientSecret == nil {
-		return fmt.Errorf("could not find Client Secret in credentials config")
-	}
+	return *config.Type
+}
 
+func (config *AzureCredentialsConfig) ValidateNotNull() error {
 	if config.SubscriptionID == nil {
 		return fmt.Errorf("could not find Subscription ID in credentials config")
 	}
 
-	return nil
-}
+	if _, err := config.CloudConfiguration(); err != nil {
+		return err
+	}
 
-func (config *AzureCredentialsConfig) CreateAzureResourceGroupsClient() (*armresources.ResourceGroupsClient, error) {
-	if err := config.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+	credentialType := config.GetType()
+	if credentialType != CredentialTypeChain {
+		return config.validateCredentialType(credentialType)
 	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create default azure credentials: %w", err)
+	if len(config.Chain) == 0 {
+		return fmt.Errorf("could not find any credential types in chain for credentials config")
 	}
 
-	resourcesClientFactory, err := armresources.NewClientFactory(*config.SubscriptionID, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create arm resources client factory: %w", err)
+	for _, chainedType := range config.Chain {
+		switch chainedType {
+		case CredentialTypeChain:
+			return fmt.Errorf("credential type %s cannot be nested in a chain", CredentialTypeChain)
+		case CredentialTypeClientSecret,
+			CredentialTypeClientCertificate,
+			CredentialTypeManagedIdentity,
+			CredentialTypeWorkloadIdentity,
+			CredentialTypeAzureCLI,
+			CredentialTypeEnvironment:
+		default:
+			return fmt.Errorf("unsupported credential type %s in chain", chainedType)
+		}
 	}
 
-	resourceGroupClient := resourcesClientFactory.NewResourceGroupsClient()
-	return resourceGroupClient, nil
+	return nil
 }
 
-func (config *AzureCredentialsConfig) CreateAzureManagedClustersClient(resourceGroupName string) (*armcontainerservice.ManagedClustersClient, error) {
-	if err := config.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+// validateCredentialType ensures the fields required by a single credential
+// type are present.
+func (config *AzureCredentialsConfig) validateCredentialType(credentialType string) error {
+	switch credentialType {
+	case CredentialTypeClientSecret:
+		if config.ClientID == nil {
+			return fmt.Errorf("could not find Client ID in credentials config")
+		}
+
+		if config.ClientSecret == nil {
+			return fmt.Errorf("could not find Client Secret in credentials config")
+		}
+
+		if config.TenantID == nil {
+			return fmt.Errorf("could not find Tenant ID in credentials config")
+		}
+	case CredentialTypeClientCertificate:
+		if config.ClientID == nil {
+			return fmt.Errorf("could not find Client ID in credentials config")
+		}
+
+		if config.CertificatePath == nil {
+			return fmt.Errorf("could not find Certificate Path in credentials config")
+		}
+
+		if config.TenantID == nil {
+			return fmt.Errorf("could not find Tenant ID in credentials config")
+		}
+	case CredentialTypeManagedIdentity,
+		CredentialTypeWorkloadIdentity,
+		CredentialTypeAzureCLI,
+		CredentialTypeEnvironment:
+		// these credential types can fall back to the hosting environment
+	default:
+		return fmt.Errorf("unsupported credential type %s in credentials config", credentialType)
 	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	return nil
+}
+
+// createTokenCredential builds the token credential described by the
+// credentials config.
+func (config *AzureCredentialsConfig) createTokenCredential() (azcore.TokenCredential, error) {
+	clientOptions, err := config.clientOptions()
 	if err != nil {
-		return nil, fmt.Errorf("could not create default azure credentials: %w", err)
+		return nil, err
 	}
 
-	containerserviceClientFactory, err := armcontainerservice.NewClientFactory(*config.SubscriptionID, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create arm container service client: %w", err)
+	credentialType := config.GetType()
+	if credentialType != CredentialTypeChain {
+		return config.createCredentialOfType(credentialType, clientOptions)
 	}
-	managedClustersClient := containerserviceClientFactory.NewManagedClustersClient()
-	return managedClustersClient, nil
-}
 
-func (config *AzureCredentialsConfig) CreateAzureSqlDatabaseClient() (*armsql.DatabasesClient, error) {
-	if err := config.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+	// credentials in a chain are optional by nature, so any that cannot be
+	// built in the current environment are skipped rather than failing
+	var sources []azcore.TokenCredential
+	for _, chainedType := range config.Chain {
+		cred, err := config.createCredentialOfType(chainedType, clientOptions)
+		if err != nil {
+			log.Printf("skipping %s credential in chain: %v", chainedType, err)
+			continue
+		}
+		sources = append(sources, cred)
 	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create default azure credentials: %w", err)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("could not create any credential in chain %v", config.Chain)
 	}
 
-	sqlClientFactory, err := armsql.NewClientFactory(*config.SubscriptionID, cred, nil)
+	cred, err := azidentity.NewChainedTokenCredential(sources, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not create new sql client: %w", err)
+		return nil, fmt.Errorf("could not create chained token credential: %w", err)
 	}
 
-	databasesClient := sqlClientFactory.NewDatabasesClient()
-	return databasesClient, nil
+	return cred, nil
 }
 
-func (config *AzureCredentialsConfig) CreateAzureSqlServersClient() (*armsql.ServersClient, error) {
-	if err := config.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
-	}
+func (config *AzureCredentialsConfig) createCredentialOfType(
+	credentialType string,
+	clientOptions azcore.ClientOptions,
+) (azcore.TokenCredential, error) {
+	// instance discovery only works against the well known clouds
+	disableInstanceDiscovery := config.GetCloud() == CloudCustom
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create default azure credentials: %w", err)
+	if err := config.validateCredentialType(credentialType); err != nil {
+		return nil, err
 	}
 
-	sqlClientFactory, err := armsql.NewClientFactory(*config.SubscriptionID, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create new client factory: %w", err)
-	}
+	switch credentialType {
+	case CredentialTypeClientSecret:
+		cred, err := azidentity.NewClientSecretCredential(
+			*config.TenantID,
+			*config.ClientID,
+			*config.ClientSecret,
+			&azidentity.ClientSecretCredentialOptions{
+				ClientOptions:            clientOptions,
+				DisableInstanceDiscovery: disableInstanceDiscovery,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not create client secret credential: %w", err)
+		}
+		return cred, nil
+	case CredentialTypeClientCertificate:
+		certData, err := os.ReadFile(*config.CertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client certificate file: %w", err)
+		}
 
-	serversClient := sqlClientFactory.NewServersClient()
-	return serversClient, nil
-}
+		var password []byte
+		if config.CertificatePassword != nil {
+			password = []byte(*config.CertificatePassword)
+		}
 
-func (config *AzureCredentialsConfig) CreateStorageAccountsClient() (*armstorage.AccountsClient, error) {
-	if err := config.ValidateNotNull(); err != nil {
-		return nil, fmt.Errorf("could not validate credentials config: %w", err)
-	}
+		certs, key, err := azidentity.ParseCertificates(certData, password)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse client certificate: %w", err)
+		}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create default azure credentials: %w", err)
-	}
+		cred, err := azidentity.NewClientCertificateCredential(
+			*config.TenantID,
+			*config.ClientID,
+			certs,
+			key,
+			&azidentity.ClientCertificateCredentialOptions{
+				ClientOptions:            clientOptions,
+				DisableInstanceDiscovery: disableInstanceDiscovery,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not create client certificate credential: %w", err)
+		}
+		return cred, nil
+	case CredentialTypeManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions}
+		if config.ClientID != nil {
+			options.ID = azidentity.ClientID(*config.ClientID)
+		}
 
-	storageClientFactory, err := armstorage.NewClientFactory(*config.SubscriptionID, cred, nil)
-	if err != nil {
-		return nil, fmt.Errorf("could not create new client factory: %w", err)
-	}
+		cred, err := azidentity.NewManagedIdentityCredential(options)
+		if err != nil {
+			return nil, fmt.Errorf("could not create managed identity credential: %w", err)
+		}
+		return cred, nil
+	case CredentialTypeWorkloadIdentity:
+		options := &azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions:            clientOptions,
+			DisableInstanceDiscovery: disableInstanceDiscovery,
+		}
+		if config.ClientID != nil {
+			options.ClientID = *config.ClientID
+		}
+		if config.TenantID != nil {
+			options.TenantID = *config.TenantID
+		}
+		if config.FederatedTokenFile != nil {
+			options.TokenFilePath = *config.FederatedTokenFile
+		}
 
-	accountsClient := storageClientFactory.NewAccountsClient()
+		cred, err := azidentity.NewWorkloadIdentityCredential(options)
+		if err != nil {
+			return nil, fmt.Errorf("could not create workload identity credential: %w", err)
+		}
+		return cred, nil
+	case CredentialTypeAzureCLI:
+		options := &azidentity.AzureCLICredentialOptions{}
+		if config.TenantID != nil {
+			options.TenantID = *config.TenantID
+		}
+
+		cred, err := azidentity.NewAzureCLICredential(options)
+		if err != nil {
+			return nil, fmt.Errorf("could not create azure cli credential: %w", err)
+		}
+		return cred, nil
+	case CredentialTypeEnvironment:
+		cred, err := azidentity.NewEnvironmentCredential(&azidentity.EnvironmentCredentialOptions{
+			ClientOptions:            clientOptions,
+			DisableInstanceDiscovery: disableInstanceDiscovery,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create environment credential: %w", err)
+		}
+		return cred, nil
+	}
 
-	return accountsClient, nil
+	return nil, fmt.Errorf("unsupported credential type %s in credentials config", credentialType)
 }
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// CustomerManagedKeyConfig configures encryption at rest with a key held in
+// Azure Key Vault. The KeyURI is the key identifier, e.g.
+// https://myvault.vault.azure.net/keys/mykey. When the URI includes a key
+// version that version is pinned, otherwise the latest version of the key is
+// used and new versions are picked up automatically when the key is rotated.
+// The user-assigned identity is attached to the resource and used to access
+// the key, so it needs get, wrapKey and unwrapKey permissions on the vault.
+type CustomerManagedKeyConfig struct {
+	KeyURI                 *string `yaml:"KeyURI"`
+	UserAssignedIdentityID *string `yaml:"UserAssignedIdentityID"`
+}
+
+func (cmk *CustomerManagedKeyConfig) Validate() error {
+	if cmk.KeyURI == nil {
+		return fmt.Errorf("could not find KeyURI in customer managed key config")
+	}
+
+	if _, _, _, err := cmk.parseKeyURI(); err != nil {
+		return err
+	}
+
+	if cmk.UserAssignedIdentityID == nil {
+		return fmt.Errorf("could not find UserAssignedIdentityID in customer managed key config")
+	}
+
+	identityID, err := arm.ParseResourceID(*cmk.UserAssignedIdentityID)
+	if err != nil {
+		return fmt.Errorf("could not parse UserAssignedIdentityID %s: %w", *cmk.UserAssignedIdentityID, err)
+	}
+
+	if !strings.EqualFold(identityID.ResourceType.String(), "Microsoft.ManagedIdentity/userAssignedIdentities") {
+		return fmt.Errorf("UserAssignedIdentityID %s is not a user-assigned managed identity", *cmk.UserAssignedIdentityID)
+	}
+
+	return nil
+}
+
+// GetVaultURI returns the URI of the key vault holding the key, e.g.
+// https://myvault.vault.azure.net/.
+func (cmk *CustomerManagedKeyConfig) GetVaultURI() string {
+	vaultURI, _, _, _ := cmk.parseKeyURI()
+	return vaultURI
+}
+
+// GetVaultName returns the name of the key vault holding the key.
+func (cmk *CustomerManagedKeyConfig) GetVaultName() string {
+	vaultURL, err := url.Parse(cmk.GetVaultURI())
+	if err != nil {
+		return ""
+	}
+
+	return strings.Split(vaultURL.Hostname(), ".")[0]
+}
+
+func (cmk *CustomerManagedKeyConfig) GetKeyName() string {
+	_, keyName, _, _ := cmk.parseKeyURI()
+	return keyName
+}
+
+// GetKeyVersion returns the pinned key version, or an empty string when the
+// key is auto-rotated.
+func (cmk *CustomerManagedKeyConfig) GetKeyVersion() string {
+	_, _, keyVersion, _ := cmk.parseKeyURI()
+	return keyVersion
+}
+
+// IsAutoRotated returns true when no key version is pinned.
+func (cmk *CustomerManagedKeyConfig) IsAutoRotated() bool {
+	return cmk.GetKeyVersion() == ""
+}
+
+// parseKeyURI splits the key URI into the vault URI, key name and optional key
+// version.
+func (cmk *CustomerManagedKeyConfig) parseKeyURI() (string, string, string, error) {
+	keyURL, err := url.Parse(*cmk.KeyURI)
+	if err != nil {
+		return "", "", "", fmt.Errorf("could not parse KeyURI %s: %w", *cmk.KeyURI, err)
+	}
+
+	if keyURL.Scheme != "https" || keyURL.Host == "" {
+		return "", "", "", fmt.Errorf("KeyURI %s must be an https key vault URI", *cmk.KeyURI)
+	}
+
+	segments := strings.Split(strings.Trim(keyURL.Path, "/"), "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[0] != "keys" || segments[1] == "" {
+		return "", "", "", fmt.Errorf("KeyURI %s must have the form https://<vault>/keys/<name>[/<version>]", *cmk.KeyURI)
+	}
+
+	keyVersion := ""
+	if len(segments) == 3 {
+		keyVersion = segments[2]
+	}
+
+	return fmt.Sprintf("https://%s/", keyURL.Host), segments[1], keyVersion, nil
+}
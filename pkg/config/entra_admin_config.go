@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Supported principal types of an entra admin.
+const (
+	EntraPrincipalTypeUser             = "User"
+	EntraPrincipalTypeGroup            = "Group"
+	EntraPrincipalTypeServicePrincipal = "ServicePrincipal"
+)
+
+// EntraAdminConfig is the Microsoft Entra ID user, group or service principal
+// that administers a database server. The tenant defaults to the tenant of the
+// Azure credentials.
+type EntraAdminConfig struct {
+	ObjectID      *string `yaml:"ObjectID"`
+	PrincipalName *string `yaml:"PrincipalName"`
+	PrincipalType *string `yaml:"PrincipalType"`
+	TenantID      *string `yaml:"TenantID"`
+}
+
+func (admin *EntraAdminConfig) Validate() error {
+	if admin.ObjectID == nil {
+		return fmt.Errorf("could not find ObjectID in entra admin config")
+	}
+
+	if _, err := uuid.Parse(*admin.ObjectID); err != nil {
+		return fmt.Errorf("ObjectID %s is not a valid object id: %w", *admin.ObjectID, err)
+	}
+
+	if admin.PrincipalName == nil {
+		return fmt.Errorf("could not find PrincipalName in entra admin config")
+	}
+
+	switch admin.GetPrincipalType() {
+	case EntraPrincipalTypeUser, EntraPrincipalTypeGroup, EntraPrincipalTypeServicePrincipal:
+	default:
+		return fmt.Errorf("unsupported PrincipalType %s", admin.GetPrincipalType())
+	}
+
+	if admin.TenantID != nil {
+		if _, err := uuid.Parse(*admin.TenantID); err != nil {
+			return fmt.Errorf("TenantID %s is not a valid tenant id: %w", *admin.TenantID, err)
+		}
+	}
+
+	return nil
+}
+
+func (admin *EntraAdminConfig) GetPrincipalType() string {
+	if admin.PrincipalType == nil {
+		return EntraPrincipalTypeUser
+	}
+
+	return *admin.PrincipalType
+}
+
+// GetTenantID returns the tenant of the admin, falling back to the tenant of
+// the Azure credentials.
+func (admin *EntraAdminConfig) GetTenantID(credentialsConfig *AzureCredentialsConfig) (string, error) {
+	if admin.TenantID != nil {
+		return *admin.TenantID, nil
+	}
+
+	if credentialsConfig.TenantID != nil && *credentialsConfig.TenantID != "" {
+		return *credentialsConfig.TenantID, nil
+	}
+
+	return "", fmt.Errorf("could not find TenantID in entra admin config or the Azure credentials")
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+)
+
+var firewallRuleNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// FirewallRuleConfig allows connections to a database server from a range of
+// public IPv4 addresses. A rule from 0.0.0.0 to 0.0.0.0 allows connections
+// from Azure services.
+type FirewallRuleConfig struct {
+	Name           *string `yaml:"Name"`
+	StartIPAddress *string `yaml:"StartIPAddress"`
+	EndIPAddress   *string `yaml:"EndIPAddress"`
+}
+
+// validateFirewallRules checks each rule and that rule names are unique.
+func validateFirewallRules(firewallRules []*FirewallRuleConfig) error {
+	ruleNames := make(map[string]bool)
+	for _, rule := range firewallRules {
+		if rule.Name == nil {
+			return fmt.Errorf("could not find Name for firewall rule")
+		}
+
+		if !firewallRuleNameRegexp.MatchString(*rule.Name) {
+			return fmt.Errorf("firewall rule name %s must be 1 to 128 letters, numbers, underscores and hyphens", *rule.Name)
+		}
+
+		if ruleNames[*rule.Name] {
+			return fmt.Errorf("firewall rule name %s is used more than once", *rule.Name)
+		}
+		ruleNames[*rule.Name] = true
+
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("could not validate firewall rule %s: %w", *rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (rule *FirewallRuleConfig) validate() error {
+	if rule.StartIPAddress == nil || rule.EndIPAddress == nil {
+		return fmt.Errorf("both StartIPAddress and EndIPAddress are required")
+	}
+
+	startIP := net.ParseIP(*rule.StartIPAddress).To4()
+	if startIP == nil {
+		return fmt.Errorf("StartIPAddress %s is not an IPv4 address", *rule.StartIPAddress)
+	}
+
+	endIP := net.ParseIP(*rule.EndIPAddress).To4()
+	if endIP == nil {
+		return fmt.Errorf("EndIPAddress %s is not an IPv4 address", *rule.EndIPAddress)
+	}
+
+	if bytes.Compare(startIP, endIP) > 0 {
+		return fmt.Errorf("StartIPAddress %s is after EndIPAddress %s", *rule.StartIPAddress, *rule.EndIPAddress)
+	}
+
+	return nil
+}
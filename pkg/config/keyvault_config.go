@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Supported SKUs of a key vault.
+const (
+	KeyVaultSKUStandard = "standard"
+	KeyVaultSKUPremium  = "premium"
+)
+
+var keyVaultNameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{1,22}[a-zA-Z0-9]$`)
+
+// AzureKeyVaultConfig is the config used to create a key vault. Access to the
+// vault is granted with Azure RBAC unless EnableRBACAuthorization is false,
+// in which case access policies have to be added to it separately.
+type AzureKeyVaultConfig struct {
+	AzureResourceConfig       `yaml:",inline"`
+	SKUName                   *string `yaml:"SKUName"`
+	TenantID                  *string `yaml:"TenantID"`
+	EnableRBACAuthorization   *bool   `yaml:"EnableRBACAuthorization"`
+	SoftDeleteRetentionInDays *int32  `yaml:"SoftDeleteRetentionInDays"`
+	EnablePurgeProtection     *bool   `yaml:"EnablePurgeProtection"`
+	PublicNetworkAccess       *bool   `yaml:"PublicNetworkAccess"`
+}
+
+func (config *AzureKeyVaultConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if !keyVaultNameRegexp.MatchString(*config.Name) || strings.Contains(*config.Name, "--") {
+		return fmt.Errorf("key vault name %s must be 3 to 24 letters, numbers and single hyphens, starting with a letter", *config.Name)
+	}
+
+	switch config.GetSKUName() {
+	case KeyVaultSKUStandard, KeyVaultSKUPremium:
+	default:
+		return fmt.Errorf("unsupported SKUName %s, must be one of %s or %s",
+			config.GetSKUName(), KeyVaultSKUStandard, KeyVaultSKUPremium)
+	}
+
+	if retention := config.GetSoftDeleteRetentionInDays(); retention < 7 || retention > 90 {
+		return fmt.Errorf("SoftDeleteRetentionInDays must be between 7 and 90, got %d", retention)
+	}
+
+	return nil
+}
+
+func (config *AzureKeyVaultConfig) GetSKUName() string {
+	if config.SKUName == nil {
+		return KeyVaultSKUStandard
+	}
+
+	return *config.SKUName
+}
+
+// GetTenantID returns the tenant of the vault, which defaults to the tenant of
+// the Azure credentials.
+func (config *AzureKeyVaultConfig) GetTenantID(credentialsConfig *AzureCredentialsConfig) (string, error) {
+	if config.TenantID != nil {
+		return *config.TenantID, nil
+	}
+
+	if credentialsConfig.TenantID != nil && *credentialsConfig.TenantID != "" {
+		return *credentialsConfig.TenantID, nil
+	}
+
+	return "", fmt.Errorf("could not find TenantID in key vault config or the Azure credentials")
+}
+
+func (config *AzureKeyVaultConfig) GetEnableRBACAuthorization() bool {
+	if config.EnableRBACAuthorization == nil {
+		return true
+	}
+
+	return *config.EnableRBACAuthorization
+}
+
+func (config *AzureKeyVaultConfig) GetSoftDeleteRetentionInDays() int32 {
+	if config.SoftDeleteRetentionInDays == nil {
+		return 90
+	}
+
+	return *config.SoftDeleteRetentionInDays
+}
+
+func (config *AzureKeyVaultConfig) GetEnablePurgeProtection() bool {
+	if config.EnablePurgeProtection == nil {
+		return false
+	}
+
+	return *config.EnablePurgeProtection
+}
+
+func (config *AzureKeyVaultConfig) GetPublicNetworkAccess() bool {
+	if config.PublicNetworkAccess == nil {
+		return true
+	}
+
+	return *config.PublicNetworkAccess
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Supported values for the version, SKU tier and high availability mode of a
+// MySQL flexible server.
+const (
+	MySqlVersion57 = "5.7"
+	MySqlVersion80 = "8.0.21"
+
+	MySqlSKUTierBurstable       = "Burstable"
+	MySqlSKUTierGeneralPurpose  = "GeneralPurpose"
+	MySqlSKUTierMemoryOptimized = "MemoryOptimized"
+
+	MySqlHighAvailabilityDisabled      = "Disabled"
+	MySqlHighAvailabilitySameZone      = "SameZone"
+	MySqlHighAvailabilityZoneRedundant = "ZoneRedundant"
+
+	defaultMySqlSKUName            = "Standard_B1ms"
+	defaultMySqlStorageSizeGB      = 20
+	defaultMySqlBackupRetention    = 7
+	defaultMySqlAdministratorLogin = "mysqladmin"
+
+	// MySqlAdministratorPasswordEnv is the environment variable the
+	// administrator password is read from when it is not in the config.
+	MySqlAdministratorPasswordEnv = "AZURE_BUILDER_MYSQL_ADMIN_PASSWORD"
+)
+
+var (
+	mySqlServerNameRegexp   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{1,61}[a-z0-9])$`)
+	mySqlDatabaseNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}$`)
+)
+
+// AzureMySqlConfig is the config used to create a MySQL flexible server and
+// its databases. Storage sizes are in GiB and backup retention is in days.
+type AzureMySqlConfig struct {
+	AzureResourceConfig     `yaml:",inline"`
+	Version                 *string           `yaml:"Version"`
+	SKUTier                 *string           `yaml:"SKUTier"`
+	SKUName                 *string           `yaml:"SKUName"`
+	StorageSizeGB           *int32            `yaml:"StorageSizeGB"`
+	StorageAutoGrow         *bool             `yaml:"StorageAutoGrow"`
+	HighAvailabilityMode    *string           `yaml:"HighAvailabilityMode"`
+	AvailabilityZone        *string           `yaml:"AvailabilityZone"`
+	StandbyAvailabilityZone *string           `yaml:"StandbyAvailabilityZone"`
+	BackupRetentionDays     *int32            `yaml:"BackupRetentionDays"`
+	GeoRedundantBackup      *bool             `yaml:"GeoRedundantBackup"`
+	AdministratorLogin      *string           `yaml:"AdministratorLogin"`
+	AdministratorPassword   *string           `yaml:"AdministratorPassword"`
+	ServerParameters        map[string]string `yaml:"ServerParameters"`
+
+	Databases     []*MySqlDatabaseConfig `yaml:"Databases"`
+	FirewallRules []*FirewallRuleConfig  `yaml:"FirewallRules"`
+}
+
+// MySqlDatabaseConfig describes a database on the MySQL flexible server.
+type MySqlDatabaseConfig struct {
+	Name      *string `yaml:"Name"`
+	Charset   *string `yaml:"Charset"`
+	Collation *string `yaml:"Collation"`
+}
+
+func (config *AzureMySqlConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if !mySqlServerNameRegexp.MatchString(*config.Name) {
+		return fmt.Errorf("server name %s must be 3 to 63 lowercase letters, numbers and hyphens", *config.Name)
+	}
+
+	switch config.GetVersion() {
+	case MySqlVersion57, MySqlVersion80:
+	default:
+		return fmt.Errorf("unsupported Version %s, must be one of %s or %s", config.GetVersion(), MySqlVersion57, MySqlVersion80)
+	}
+
+	switch config.GetSKUTier() {
+	case MySqlSKUTierBurstable, MySqlSKUTierGeneralPurpose, MySqlSKUTierMemoryOptimized:
+	default:
+		return fmt.Errorf("unsupported SKUTier %s", config.GetSKUTier())
+	}
+
+	if config.GetStorageSizeGB() < 20 || config.GetStorageSizeGB() > 16384 {
+		return fmt.Errorf("StorageSizeGB must be between 20 and 16384, got %d", config.GetStorageSizeGB())
+	}
+
+	switch config.GetHighAvailabilityMode() {
+	case MySqlHighAvailabilityDisabled:
+		if config.StandbyAvailabilityZone != nil {
+			return fmt.Errorf("StandbyAvailabilityZone requires HighAvailabilityMode %s", MySqlHighAvailabilityZoneRedundant)
+		}
+	case MySqlHighAvailabilitySameZone, MySqlHighAvailabilityZoneRedundant:
+		if config.GetSKUTier() == MySqlSKUTierBurstable {
+			return fmt.Errorf("HighAvailabilityMode %s is not available with SKUTier %s",
+				config.GetHighAvailabilityMode(), MySqlSKUTierBurstable)
+		}
+	default:
+		return fmt.Errorf("unsupported HighAvailabilityMode %s", config.GetHighAvailabilityMode())
+	}
+
+	if config.GetBackupRetentionDays() < 1 || config.GetBackupRetentionDays() > 35 {
+		return fmt.Errorf("BackupRetentionDays must be between 1 and 35, got %d", config.GetBackupRetentionDays())
+	}
+
+	databaseNames := make(map[string]bool)
+	for _, database := range config.Databases {
+		if database.Name == nil {
+			return fmt.Errorf("could not find Name for database")
+		}
+
+		if !mySqlDatabaseNameRegexp.MatchString(*database.Name) {
+			return fmt.Errorf("database name %s must be 1 to 64 letters, numbers, underscores and dollar signs", *database.Name)
+		}
+
+		if databaseNames[*database.Name] {
+			return fmt.Errorf("database name %s is used more than once", *database.Name)
+		}
+		databaseNames[*database.Name] = true
+	}
+
+	if err := validateFirewallRules(config.FirewallRules); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (config *AzureMySqlConfig) GetVersion() string {
+	if config.Version == nil {
+		return MySqlVersion80
+	}
+
+	return *config.Version
+}
+
+func (config *AzureMySqlConfig) GetSKUTier() string {
+	if config.SKUTier == nil {
+		return MySqlSKUTierBurstable
+	}
+
+	return *config.SKUTier
+}
+
+func (config *AzureMySqlConfig) GetSKUName() string {
+	if config.SKUName == nil {
+		return defaultMySqlSKUName
+	}
+
+	return *config.SKUName
+}
+
+func (config *AzureMySqlConfig) GetStorageSizeGB() int32 {
+	if config.StorageSizeGB == nil {
+		return defaultMySqlStorageSizeGB
+	}
+
+	return *config.StorageSizeGB
+}
+
+func (config *AzureMySqlConfig) GetStorageAutoGrow() bool {
+	if config.StorageAutoGrow == nil {
+		return true
+	}
+
+	return *config.StorageAutoGrow
+}
+
+func (config *AzureMySqlConfig) GetHighAvailabilityMode() string {
+	if config.HighAvailabilityMode == nil {
+		return MySqlHighAvailabilityDisabled
+	}
+
+	return *config.HighAvailabilityMode
+}
+
+func (config *AzureMySqlConfig) GetBackupRetentionDays() int32 {
+	if config.BackupRetentionDays == nil {
+		return defaultMySqlBackupRetention
+	}
+
+	return *config.BackupRetentionDays
+}
+
+func (config *AzureMySqlConfig) GetGeoRedundantBackup() bool {
+	if config.GeoRedundantBackup == nil {
+		return false
+	}
+
+	return *config.GeoRedundantBackup
+}
+
+func (config *AzureMySqlConfig) GetAdministratorLogin() string {
+	if config.AdministratorLogin == nil {
+		return defaultMySqlAdministratorLogin
+	}
+
+	return *config.AdministratorLogin
+}
+
+// GetAdministratorPassword returns the administrator password from the config,
+// falling back to the MySqlAdministratorPasswordEnv environment variable.
+func (config *AzureMySqlConfig) GetAdministratorPassword() (string, error) {
+	password, ok := administratorPassword(config.AdministratorPassword, MySqlAdministratorPasswordEnv)
+	if !ok {
+		return "", fmt.Errorf("could not find AdministratorPassword in mysql config or %s in the environment", MySqlAdministratorPasswordEnv)
+	}
+
+	return password, nil
+}
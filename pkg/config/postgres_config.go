@@ -0,0 +1,336 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// Supported values for the version, SKU tier and high availability mode of a
+// PostgreSQL flexible server.
+const (
+	PostgresVersion13 = "13"
+	PostgresVersion14 = "14"
+	PostgresVersion15 = "15"
+	PostgresVersion16 = "16"
+
+	PostgresSKUTierBurstable       = "Burstable"
+	PostgresSKUTierGeneralPurpose  = "GeneralPurpose"
+	PostgresSKUTierMemoryOptimized = "MemoryOptimized"
+
+	PostgresHighAvailabilityDisabled      = "Disabled"
+	PostgresHighAvailabilitySameZone      = "SameZone"
+	PostgresHighAvailabilityZoneRedundant = "ZoneRedundant"
+
+	defaultPostgresSKUName            = "Standard_B1ms"
+	defaultPostgresStorageSizeGB      = 32
+	defaultPostgresBackupRetention    = 7
+	defaultPostgresAdministratorLogin = "pgadmin"
+
+	// PostgresAdministratorPasswordEnv is the environment variable the
+	// administrator password is read from when it is not in the config.
+	PostgresAdministratorPasswordEnv = "AZURE_BUILDER_POSTGRES_ADMIN_PASSWORD"
+)
+
+var (
+	postgresServerNameRegexp   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{1,61}[a-z0-9])$`)
+	postgresDatabaseNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]{0,62}$`)
+
+	// premium SSD sizes supported by flexible server storage
+	postgresStorageSizesGB = []int32{32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32767}
+)
+
+// AzurePostgresConfig is the config used to create a PostgreSQL flexible
+// server and its databases. Storage sizes are in GiB and backup retention is in
+// days. Extensions lists the extensions that may be created in the databases.
+type AzurePostgresConfig struct {
+	AzureResourceConfig     `yaml:",inline"`
+	Version                 *string           `yaml:"Version"`
+	SKUTier                 *string           `yaml:"SKUTier"`
+	SKUName                 *string           `yaml:"SKUName"`
+	StorageSizeGB           *int32            `yaml:"StorageSizeGB"`
+	StorageAutoGrow         *bool             `yaml:"StorageAutoGrow"`
+	HighAvailabilityMode    *string           `yaml:"HighAvailabilityMode"`
+	AvailabilityZone        *string           `yaml:"AvailabilityZone"`
+	StandbyAvailabilityZone *string           `yaml:"StandbyAvailabilityZone"`
+	BackupRetentionDays     *int32            `yaml:"BackupRetentionDays"`
+	GeoRedundantBackup      *bool             `yaml:"GeoRedundantBackup"`
+	AdministratorLogin      *string           `yaml:"AdministratorLogin"`
+	AdministratorPassword   *string           `yaml:"AdministratorPassword"`
+	PasswordAuth            *bool             `yaml:"PasswordAuth"`
+	EntraAdmin              *EntraAdminConfig `yaml:"EntraAdmin"`
+	Extensions              []string          `yaml:"Extensions"`
+	ServerParameters        map[string]string `yaml:"ServerParameters"`
+
+	Databases     []*PostgresDatabaseConfig `yaml:"Databases"`
+	FirewallRules []*FirewallRuleConfig     `yaml:"FirewallRules"`
+	Network       *PostgresNetworkConfig    `yaml:"Network"`
+}
+
+// PostgresDatabaseConfig describes a database on the PostgreSQL flexible
+// server.
+type PostgresDatabaseConfig struct {
+	Name      *string `yaml:"Name"`
+	Charset   *string `yaml:"Charset"`
+	Collation *string `yaml:"Collation"`
+}
+
+// PostgresNetworkConfig integrates the server into a virtual network. The
+// subnet has to be delegated to Microsoft.DBforPostgreSQL/flexibleServers and
+// a server with a delegated subnet has no public access, so firewall rules
+// cannot be used with it.
+type PostgresNetworkConfig struct {
+	DelegatedSubnetID *string `yaml:"DelegatedSubnetID"`
+	PrivateDNSZoneID  *string `yaml:"PrivateDNSZoneID"`
+}
+
+func (config *AzurePostgresConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if !postgresServerNameRegexp.MatchString(*config.Name) {
+		return fmt.Errorf("server name %s must be 3 to 63 lowercase letters, numbers and hyphens", *config.Name)
+	}
+
+	switch config.GetVersion() {
+	case PostgresVersion13, PostgresVersion14, PostgresVersion15, PostgresVersion16:
+	default:
+		return fmt.Errorf("unsupported Version %s", config.GetVersion())
+	}
+
+	switch config.GetSKUTier() {
+	case PostgresSKUTierBurstable, PostgresSKUTierGeneralPurpose, PostgresSKUTierMemoryOptimized:
+	default:
+		return fmt.Errorf("unsupported SKUTier %s", config.GetSKUTier())
+	}
+
+	if !validPostgresStorageSize(config.GetStorageSizeGB()) {
+		return fmt.Errorf("unsupported StorageSizeGB %d, must be one of %v", config.GetStorageSizeGB(), postgresStorageSizesGB)
+	}
+
+	switch config.GetHighAvailabilityMode() {
+	case PostgresHighAvailabilityDisabled:
+		if config.StandbyAvailabilityZone != nil {
+			return fmt.Errorf("StandbyAvailabilityZone requires HighAvailabilityMode %s", PostgresHighAvailabilityZoneRedundant)
+		}
+	case PostgresHighAvailabilitySameZone, PostgresHighAvailabilityZoneRedundant:
+		if config.GetSKUTier() == PostgresSKUTierBurstable {
+			return fmt.Errorf("HighAvailabilityMode %s is not available with SKUTier %s",
+				config.GetHighAvailabilityMode(), PostgresSKUTierBurstable)
+		}
+	default:
+		return fmt.Errorf("unsupported HighAvailabilityMode %s", config.GetHighAvailabilityMode())
+	}
+
+	if config.GetBackupRetentionDays() < 7 || config.GetBackupRetentionDays() > 35 {
+		return fmt.Errorf("BackupRetentionDays must be between 7 and 35, got %d", config.GetBackupRetentionDays())
+	}
+
+	if !config.GetPasswordAuth() && config.EntraAdmin == nil {
+		return fmt.Errorf("an EntraAdmin is required when PasswordAuth is disabled")
+	}
+
+	if config.EntraAdmin != nil {
+		if err := config.EntraAdmin.Validate(); err != nil {
+			return fmt.Errorf("could not validate entra admin: %w", err)
+		}
+	}
+
+	for _, extension := range config.Extensions {
+		if extension == "" || strings.Contains(extension, ",") {
+			return fmt.Errorf("invalid extension name %q", extension)
+		}
+	}
+
+	if _, ok := config.ServerParameters[postgresExtensionsParameter]; ok && len(config.Extensions) > 0 {
+		return fmt.Errorf("set extensions with either Extensions or the %s server parameter, not both", postgresExtensionsParameter)
+	}
+
+	databaseNames := make(map[string]bool)
+	for _, database := range config.Databases {
+		if database.Name == nil {
+			return fmt.Errorf("could not find Name for database")
+		}
+
+		if !postgresDatabaseNameRegexp.MatchString(*database.Name) {
+			return fmt.Errorf("database name %s must be 1 to 63 letters, numbers, underscores and dollar signs and not start with a number", *database.Name)
+		}
+
+		if databaseNames[*database.Name] {
+			return fmt.Errorf("database name %s is used more than once", *database.Name)
+		}
+		databaseNames[*database.Name] = true
+	}
+
+	if err := validateFirewallRules(config.FirewallRules); err != nil {
+		return err
+	}
+
+	if config.Network != nil {
+		if err := config.Network.Validate(); err != nil {
+			return fmt.Errorf("could not validate network: %w", err)
+		}
+
+		if config.Network.DelegatedSubnetID != nil && len(config.FirewallRules) > 0 {
+			return fmt.Errorf("firewall rules cannot be used with a delegated subnet")
+		}
+	}
+
+	return nil
+}
+
+// postgresExtensionsParameter is the server parameter that holds the
+// extension allow-list.
+const postgresExtensionsParameter = "azure.extensions"
+
+// GetServerParameters returns the server parameters to set, including the
+// extension allow-list.
+func (config *AzurePostgresConfig) GetServerParameters() map[string]string {
+	parameters := make(map[string]string, len(config.ServerParameters)+1)
+	for name, value := range config.ServerParameters {
+		parameters[name] = value
+	}
+
+	if len(config.Extensions) > 0 {
+		parameters[postgresExtensionsParameter] = strings.Join(config.Extensions, ",")
+	}
+
+	return parameters
+}
+
+func validPostgresStorageSize(sizeGB int32) bool {
+	for _, supported := range postgresStorageSizesGB {
+		if sizeGB == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (network *PostgresNetworkConfig) Validate() error {
+	if network.DelegatedSubnetID == nil {
+		if network.PrivateDNSZoneID != nil {
+			return fmt.Errorf("PrivateDNSZoneID requires DelegatedSubnetID")
+		}
+		return nil
+	}
+
+	subnetID, err := arm.ParseResourceID(*network.DelegatedSubnetID)
+	if err != nil {
+		return fmt.Errorf("could not parse DelegatedSubnetID %s: %w", *network.DelegatedSubnetID, err)
+	}
+
+	if !strings.EqualFold(subnetID.ResourceType.String(), "Microsoft.Network/virtualNetworks/subnets") {
+		return fmt.Errorf("DelegatedSubnetID %s is not a subnet", *network.DelegatedSubnetID)
+	}
+
+	if network.PrivateDNSZoneID != nil {
+		zoneID, err := arm.ParseResourceID(*network.PrivateDNSZoneID)
+		if err != nil {
+			return fmt.Errorf("could not parse PrivateDNSZoneID %s: %w", *network.PrivateDNSZoneID, err)
+		}
+
+		if !strings.EqualFold(zoneID.ResourceType.String(), "Microsoft.Network/privateDnsZones") {
+			return fmt.Errorf("PrivateDNSZoneID %s is not a private DNS zone", *network.PrivateDNSZoneID)
+		}
+	}
+
+	return nil
+}
+
+func (config *AzurePostgresConfig) GetVersion() string {
+	if config.Version == nil {
+		return PostgresVersion16
+	}
+
+	return *config.Version
+}
+
+func (config *AzurePostgresConfig) GetSKUTier() string {
+	if config.SKUTier == nil {
+		return PostgresSKUTierBurstable
+	}
+
+	return *config.SKUTier
+}
+
+func (config *AzurePostgresConfig) GetSKUName() string {
+	if config.SKUName == nil {
+		return defaultPostgresSKUName
+	}
+
+	return *config.SKUName
+}
+
+func (config *AzurePostgresConfig) GetStorageSizeGB() int32 {
+	if config.StorageSizeGB == nil {
+		return defaultPostgresStorageSizeGB
+	}
+
+	return *config.StorageSizeGB
+}
+
+func (config *AzurePostgresConfig) GetStorageAutoGrow() bool {
+	if config.StorageAutoGrow == nil {
+		return true
+	}
+
+	return *config.StorageAutoGrow
+}
+
+func (config *AzurePostgresConfig) GetHighAvailabilityMode() string {
+	if config.HighAvailabilityMode == nil {
+		return PostgresHighAvailabilityDisabled
+	}
+
+	return *config.HighAvailabilityMode
+}
+
+func (config *AzurePostgresConfig) GetBackupRetentionDays() int32 {
+	if config.BackupRetentionDays == nil {
+		return defaultPostgresBackupRetention
+	}
+
+	return *config.BackupRetentionDays
+}
+
+func (config *AzurePostgresConfig) GetGeoRedundantBackup() bool {
+	if config.GeoRedundantBackup == nil {
+		return false
+	}
+
+	return *config.GeoRedundantBackup
+}
+
+func (config *AzurePostgresConfig) GetAdministratorLogin() string {
+	if config.AdministratorLogin == nil {
+		return defaultPostgresAdministratorLogin
+	}
+
+	return *config.AdministratorLogin
+}
+
+// GetAdministratorPassword returns the administrator password from the config,
+// falling back to the PostgresAdministratorPasswordEnv environment variable.
+func (config *AzurePostgresConfig) GetAdministratorPassword() (string, error) {
+	password, ok := administratorPassword(config.AdministratorPassword, PostgresAdministratorPasswordEnv)
+	if !ok {
+		return "", fmt.Errorf("could not find AdministratorPassword in postgres config or %s in the environment", PostgresAdministratorPasswordEnv)
+	}
+
+	return password, nil
+}
+
+// GetPasswordAuth returns whether the administrator can sign in with a
+// password, which is enabled unless it is turned off in the config.
+func (config *AzurePostgresConfig) GetPasswordAuth() bool {
+	if config.PasswordAuth == nil {
+		return true
+	}
+
+	return *config.PasswordAuth
+}
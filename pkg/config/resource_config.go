@@ -1,7 +1,36 @@
 package config
 
+import "fmt"
+
 type AzureResourceConfig struct {
 	Name          *string `yaml:"Name"`
 	ResourceGroup *string `yaml:"ResourceGroup"`
 	Region        *string `yaml:"Region"`
+	StackName     *string `yaml:"StackName"`
+}
+
+// GetStackName returns the name of the stack that owns the resources, which
+// defaults to the resource name.
+func (config *AzureResourceConfig) GetStackName() string {
+	if config.StackName == nil || *config.StackName == "" {
+		return *config.Name
+	}
+
+	return *config.StackName
+}
+
+func (config *AzureResourceConfig) ValidateNotNull() error {
+	if config.Name == nil {
+		return fmt.Errorf("could not find Name in resource config")
+	}
+
+	if config.ResourceGroup == nil {
+		return fmt.Errorf("could not find ResourceGroup in resource config")
+	}
+
+	if config.Region == nil {
+		return fmt.Errorf("could not find Region in resource config")
+	}
+
+	return nil
 }
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Supported secret sink types.
+const (
+	SecretSinkTypeFile     = "File"
+	SecretSinkTypeStdout   = "Stdout"
+	SecretSinkTypeKeyVault = "KeyVault"
+)
+
+var keyVaultSecretNameRegexp = regexp.MustCompile(`^[A-Za-z0-9-]{1,127}$`)
+
+// SecretSinkConfig configures where a generated secret such as a database
+// administrator password is written to. A File sink writes the secret to Path
+// with mode 0600, a Stdout sink prints it once and a KeyVault sink stores it
+// as the secret SecretName in the vault at KeyVaultURI, e.g.
+// https://myvault.vault.azure.net/. Writing to a vault goes through Azure
+// Resource Manager, so the credentials need the
+// Microsoft.KeyVault/vaults/secrets/write permission on the vault.
+type SecretSinkConfig struct {
+	Type        *string `yaml:"Type"`
+	Path        *string `yaml:"Path"`
+	KeyVaultURI *string `yaml:"KeyVaultURI"`
+	SecretName  *string `yaml:"SecretName"`
+}
+
+func (sink *SecretSinkConfig) Validate() error {
+	switch sink.GetType() {
+	case SecretSinkTypeFile:
+		if sink.Path != nil && *sink.Path == "" {
+			return fmt.Errorf("Path of a %s secret sink must not be empty", SecretSinkTypeFile)
+		}
+	case SecretSinkTypeStdout:
+	case SecretSinkTypeKeyVault:
+		if sink.KeyVaultURI == nil {
+			return fmt.Errorf("could not find KeyVaultURI in %s secret sink config", SecretSinkTypeKeyVault)
+		}
+
+		vaultURL, err := url.Parse(*sink.KeyVaultURI)
+		if err != nil {
+			return fmt.Errorf("could not parse KeyVaultURI %s: %w", *sink.KeyVaultURI, err)
+		}
+
+		if vaultURL.Scheme != "https" || vaultURL.Host == "" || strings.Trim(vaultURL.Path, "/") != "" {
+			return fmt.Errorf("KeyVaultURI %s must have the form https://<vault>/", *sink.KeyVaultURI)
+		}
+
+		if sink.SecretName != nil && !keyVaultSecretNameRegexp.MatchString(*sink.SecretName) {
+			return fmt.Errorf("secret name %s must be 1 to 127 letters, numbers and hyphens", *sink.SecretName)
+		}
+	default:
+		return fmt.Errorf("unsupported secret sink Type %s, must be one of %s, %s or %s",
+			sink.GetType(), SecretSinkTypeFile, SecretSinkTypeStdout, SecretSinkTypeKeyVault)
+	}
+
+	return nil
+}
+
+func (sink *SecretSinkConfig) GetType() string {
+	if sink.Type == nil {
+		return SecretSinkTypeFile
+	}
+
+	return *sink.Type
+}
+
+// GetPath returns the file the secret is written to, falling back to the
+// given default.
+func (sink *SecretSinkConfig) GetPath(defaultPath string) string {
+	if sink.Path == nil {
+		return defaultPath
+	}
+
+	return *sink.Path
+}
+
+// GetVaultName returns the name of the key vault the secret is stored in.
+func (sink *SecretSinkConfig) GetVaultName() string {
+	if sink.KeyVaultURI == nil {
+		return ""
+	}
+
+	vaultURL, err := url.Parse(*sink.KeyVaultURI)
+	if err != nil {
+		return ""
+	}
+
+	return strings.Split(vaultURL.Hostname(), ".")[0]
+}
+
+// GetSecretName returns the name of the key vault secret, falling back to the
+// given default.
+func (sink *SecretSinkConfig) GetSecretName(defaultName string) string {
+	if sink.SecretName == nil {
+		return defaultName
+	}
+
+	return *sink.SecretName
+}
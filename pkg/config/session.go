@@ -0,0 +1,495 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/msi/armmsi"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/mysql/armmysqlflexibleservers"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/postgresql/armpostgresqlflexibleservers/v4"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// AzureSession holds the token credential and ARM client factories built from
+// a credentials config. The credential caches its tokens, so a single session
+// should be created once and shared between calls. It is safe for concurrent
+// use.
+type AzureSession struct {
+	CredentialsConfig *AzureCredentialsConfig
+
+	credential       azcore.TokenCredential
+	armClientOptions *arm.ClientOptions
+
+	mutex                         sync.Mutex
+	resourcesClientFactory        *armresources.ClientFactory
+	containerserviceClientFactory *armcontainerservice.ClientFactory
+	sqlClientFactory              *armsql.ClientFactory
+	storageClientFactory          *armstorage.ClientFactory
+	keyvaultClientFactory         *armkeyvault.ClientFactory
+	msiClientFactory              *armmsi.ClientFactory
+	authorizationClientFactory    *armauthorization.ClientFactory
+	mysqlClientFactory            *armmysqlflexibleservers.ClientFactory
+	postgresClientFactory         *armpostgresqlflexibleservers.ClientFactory
+}
+
+func NewAzureSession(credentialsConfig *AzureCredentialsConfig) (*AzureSession, error) {
+	if err := credentialsConfig.ValidateNotNull(); err != nil {
+		return nil, fmt.Errorf("could not validate credentials config: %w", err)
+	}
+
+	cred, err := credentialsConfig.createTokenCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	armClientOptions, err := credentialsConfig.armClientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureSession{
+		CredentialsConfig: credentialsConfig,
+		credential:        cred,
+		armClientOptions:  armClientOptions,
+	}, nil
+}
+
+// TokenCredential returns the credential shared by all clients of the session.
+func (session *AzureSession) TokenCredential() azcore.TokenCredential {
+	return session.credential
+}
+
+// SubscriptionID returns the subscription all clients of the session target.
+func (session *AzureSession) SubscriptionID() string {
+	return *session.CredentialsConfig.SubscriptionID
+}
+
+func (session *AzureSession) CreateAzureResourceGroupsClient() (*armresources.ResourceGroupsClient, error) {
+	resourcesClientFactory, err := session.getResourcesClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return resourcesClientFactory.NewResourceGroupsClient(), nil
+}
+
+func (session *AzureSession) CreateAzureResourcesClient() (*armresources.Client, error) {
+	resourcesClientFactory, err := session.getResourcesClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return resourcesClientFactory.NewClient(), nil
+}
+
+func (session *AzureSession) CreateAzureManagedClustersClient() (*armcontainerservice.ManagedClustersClient, error) {
+	containerserviceClientFactory, err := session.getContainerserviceClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return containerserviceClientFactory.NewManagedClustersClient(), nil
+}
+
+func (session *AzureSession) CreateAzureAgentPoolsClient() (*armcontainerservice.AgentPoolsClient, error) {
+	containerserviceClientFactory, err := session.getContainerserviceClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return containerserviceClientFactory.NewAgentPoolsClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlDatabaseClient() (*armsql.DatabasesClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewDatabasesClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlServersClient() (*armsql.ServersClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewServersClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlServerKeysClient() (*armsql.ServerKeysClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewServerKeysClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlEncryptionProtectorsClient() (*armsql.EncryptionProtectorsClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewEncryptionProtectorsClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlFirewallRulesClient() (*armsql.FirewallRulesClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewFirewallRulesClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlVirtualNetworkRulesClient() (*armsql.VirtualNetworkRulesClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewVirtualNetworkRulesClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlServerAzureADAdministratorsClient() (*armsql.ServerAzureADAdministratorsClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewServerAzureADAdministratorsClient(), nil
+}
+
+func (session *AzureSession) CreateAzureSqlServerAzureADOnlyAuthenticationsClient() (*armsql.ServerAzureADOnlyAuthenticationsClient, error) {
+	sqlClientFactory, err := session.getSqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlClientFactory.NewServerAzureADOnlyAuthenticationsClient(), nil
+}
+
+func (session *AzureSession) CreateStorageAccountsClient() (*armstorage.AccountsClient, error) {
+	storageClientFactory, err := session.getStorageClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClientFactory.NewAccountsClient(), nil
+}
+
+func (session *AzureSession) CreateBlobContainersClient() (*armstorage.BlobContainersClient, error) {
+	storageClientFactory, err := session.getStorageClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClientFactory.NewBlobContainersClient(), nil
+}
+
+func (session *AzureSession) CreateQueueClient() (*armstorage.QueueClient, error) {
+	storageClientFactory, err := session.getStorageClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClientFactory.NewQueueClient(), nil
+}
+
+func (session *AzureSession) CreateFileSharesClient() (*armstorage.FileSharesClient, error) {
+	storageClientFactory, err := session.getStorageClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClientFactory.NewFileSharesClient(), nil
+}
+
+func (session *AzureSession) CreateBlobServicesClient() (*armstorage.BlobServicesClient, error) {
+	storageClientFactory, err := session.getStorageClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClientFactory.NewBlobServicesClient(), nil
+}
+
+func (session *AzureSession) CreateManagementPoliciesClient() (*armstorage.ManagementPoliciesClient, error) {
+	storageClientFactory, err := session.getStorageClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return storageClientFactory.NewManagementPoliciesClient(), nil
+}
+
+func (session *AzureSession) CreateKeyVaultVaultsClient() (*armkeyvault.VaultsClient, error) {
+	keyvaultClientFactory, err := session.getKeyvaultClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return keyvaultClientFactory.NewVaultsClient(), nil
+}
+
+func (session *AzureSession) CreateKeyVaultKeysClient() (*armkeyvault.KeysClient, error) {
+	keyvaultClientFactory, err := session.getKeyvaultClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return keyvaultClientFactory.NewKeysClient(), nil
+}
+
+func (session *AzureSession) CreateKeyVaultSecretsClient() (*armkeyvault.SecretsClient, error) {
+	keyvaultClientFactory, err := session.getKeyvaultClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return keyvaultClientFactory.NewSecretsClient(), nil
+}
+
+func (session *AzureSession) CreateUserAssignedIdentitiesClient() (*armmsi.UserAssignedIdentitiesClient, error) {
+	msiClientFactory, err := session.getMsiClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return msiClientFactory.NewUserAssignedIdentitiesClient(), nil
+}
+
+func (session *AzureSession) CreateRoleAssignmentsClient() (*armauthorization.RoleAssignmentsClient, error) {
+	authorizationClientFactory, err := session.getAuthorizationClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return authorizationClientFactory.NewRoleAssignmentsClient(), nil
+}
+
+func (session *AzureSession) CreateMySqlServersClient() (*armmysqlflexibleservers.ServersClient, error) {
+	mysqlClientFactory, err := session.getMysqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return mysqlClientFactory.NewServersClient(), nil
+}
+
+func (session *AzureSession) CreateMySqlDatabasesClient() (*armmysqlflexibleservers.DatabasesClient, error) {
+	mysqlClientFactory, err := session.getMysqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return mysqlClientFactory.NewDatabasesClient(), nil
+}
+
+func (session *AzureSession) CreateMySqlFirewallRulesClient() (*armmysqlflexibleservers.FirewallRulesClient, error) {
+	mysqlClientFactory, err := session.getMysqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return mysqlClientFactory.NewFirewallRulesClient(), nil
+}
+
+func (session *AzureSession) CreateMySqlConfigurationsClient() (*armmysqlflexibleservers.ConfigurationsClient, error) {
+	mysqlClientFactory, err := session.getMysqlClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return mysqlClientFactory.NewConfigurationsClient(), nil
+}
+
+func (session *AzureSession) CreatePostgresServersClient() (*armpostgresqlflexibleservers.ServersClient, error) {
+	postgresClientFactory, err := session.getPostgresClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresClientFactory.NewServersClient(), nil
+}
+
+func (session *AzureSession) CreatePostgresDatabasesClient() (*armpostgresqlflexibleservers.DatabasesClient, error) {
+	postgresClientFactory, err := session.getPostgresClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresClientFactory.NewDatabasesClient(), nil
+}
+
+func (session *AzureSession) CreatePostgresFirewallRulesClient() (*armpostgresqlflexibleservers.FirewallRulesClient, error) {
+	postgresClientFactory, err := session.getPostgresClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresClientFactory.NewFirewallRulesClient(), nil
+}
+
+func (session *AzureSession) CreatePostgresConfigurationsClient() (*armpostgresqlflexibleservers.ConfigurationsClient, error) {
+	postgresClientFactory, err := session.getPostgresClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresClientFactory.NewConfigurationsClient(), nil
+}
+
+func (session *AzureSession) CreatePostgresAdministratorsClient() (*armpostgresqlflexibleservers.AdministratorsClient, error) {
+	postgresClientFactory, err := session.getPostgresClientFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresClientFactory.NewAdministratorsClient(), nil
+}
+
+func (session *AzureSession) getResourcesClientFactory() (*armresources.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.resourcesClientFactory == nil {
+		resourcesClientFactory, err := armresources.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm resources client factory: %w", err)
+		}
+		session.resourcesClientFactory = resourcesClientFactory
+	}
+
+	return session.resourcesClientFactory, nil
+}
+
+func (session *AzureSession) getContainerserviceClientFactory() (*armcontainerservice.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.containerserviceClientFactory == nil {
+		containerserviceClientFactory, err := armcontainerservice.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm container service client factory: %w", err)
+		}
+		session.containerserviceClientFactory = containerserviceClientFactory
+	}
+
+	return session.containerserviceClientFactory, nil
+}
+
+func (session *AzureSession) getSqlClientFactory() (*armsql.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.sqlClientFactory == nil {
+		sqlClientFactory, err := armsql.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm sql client factory: %w", err)
+		}
+		session.sqlClientFactory = sqlClientFactory
+	}
+
+	return session.sqlClientFactory, nil
+}
+
+func (session *AzureSession) getStorageClientFactory() (*armstorage.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.storageClientFactory == nil {
+		storageClientFactory, err := armstorage.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm storage client factory: %w", err)
+		}
+		session.storageClientFactory = storageClientFactory
+	}
+
+	return session.storageClientFactory, nil
+}
+
+func (session *AzureSession) getKeyvaultClientFactory() (*armkeyvault.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.keyvaultClientFactory == nil {
+		keyvaultClientFactory, err := armkeyvault.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm key vault client factory: %w", err)
+		}
+		session.keyvaultClientFactory = keyvaultClientFactory
+	}
+
+	return session.keyvaultClientFactory, nil
+}
+
+func (session *AzureSession) getMsiClientFactory() (*armmsi.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.msiClientFactory == nil {
+		msiClientFactory, err := armmsi.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm managed identity client factory: %w", err)
+		}
+		session.msiClientFactory = msiClientFactory
+	}
+
+	return session.msiClientFactory, nil
+}
+
+func (session *AzureSession) getAuthorizationClientFactory() (*armauthorization.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.authorizationClientFactory == nil {
+		authorizationClientFactory, err := armauthorization.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm authorization client factory: %w", err)
+		}
+		session.authorizationClientFactory = authorizationClientFactory
+	}
+
+	return session.authorizationClientFactory, nil
+}
+
+func (session *AzureSession) getMysqlClientFactory() (*armmysqlflexibleservers.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.mysqlClientFactory == nil {
+		mysqlClientFactory, err := armmysqlflexibleservers.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm mysql flexible servers client factory: %w", err)
+		}
+		session.mysqlClientFactory = mysqlClientFactory
+	}
+
+	return session.mysqlClientFactory, nil
+}
+
+func (session *AzureSession) getPostgresClientFactory() (*armpostgresqlflexibleservers.ClientFactory, error) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.postgresClientFactory == nil {
+		postgresClientFactory, err := armpostgresqlflexibleservers.NewClientFactory(session.SubscriptionID(), session.credential, session.armClientOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not create arm postgresql flexible servers client factory: %w", err)
+		}
+		session.postgresClientFactory = postgresClientFactory
+	}
+
+	return session.postgresClientFactory, nil
+}
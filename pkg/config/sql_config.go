@@ -0,0 +1,580 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+)
+
+// Supported backup storage redundancies of an Azure SQL database.
+const (
+	SqlBackupStorageRedundancyLocal   = "Local"
+	SqlBackupStorageRedundancyZone    = "Zone"
+	SqlBackupStorageRedundancyGeo     = "Geo"
+	SqlBackupStorageRedundancyGeoZone = "GeoZone"
+)
+
+// Supported minimal TLS versions of an Azure SQL server.
+const (
+	SqlMinimalTLSVersion10 = "1.0"
+	SqlMinimalTLSVersion11 = "1.1"
+	SqlMinimalTLSVersion12 = "1.2"
+	SqlMinimalTLSVersion13 = "1.3"
+)
+
+const (
+	// SqlAllowAzureServicesRuleName is the name of the firewall rule that
+	// allows connections from Azure services when AllowAzureServices is set.
+	SqlAllowAzureServicesRuleName = "AllowAllWindowsAzureIps"
+
+	defaultSqlAdministratorLogin = "sqladmin"
+
+	defaultSqlDatabaseSKUName          = "GP_S_Gen5"
+	defaultSqlDatabaseCapacity         = 1
+	defaultSqlDatabaseMinCapacity      = 0.5
+	defaultSqlDatabaseAutoPauseMinutes = 60
+
+	// SqlAdministratorPasswordEnv is the environment variable the
+	// administrator password is read from when it is not in the config.
+	SqlAdministratorPasswordEnv = "AZURE_BUILDER_SQL_ADMIN_PASSWORD"
+)
+
+var (
+	sqlAdministratorLoginRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,127}$`)
+	sqlServerNameRegexp         = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	sqlDatabaseNameRegexp       = regexp.MustCompile(`^[^<>*%&:\\/?]{0,127}[^<>*%&:\\/?. ]$`)
+
+	// sqlDTUSKUNameRegexp matches the DTU-based service objectives, every
+	// other SKU name is vCore-based, e.g. GP_Gen5 or BC_Gen5.
+	sqlDTUSKUNameRegexp = regexp.MustCompile(`^(Basic|S[0-9]+|P[0-9]+)$`)
+)
+
+// reservedSqlAdministratorLogins are the login names Azure SQL does not
+// accept for the server administrator.
+var reservedSqlAdministratorLogins = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"sa":            true,
+	"root":          true,
+	"dbmanager":     true,
+	"loginmanager":  true,
+	"dbo":           true,
+	"guest":         true,
+	"public":        true,
+}
+
+// AzureSqlConfig is the config used to create an Azure SQL server and its
+// databases. The server is named ServerName, falling back to Name, and when
+// no databases are listed a single database with the server name and default
+// settings is created. Databases are added to the server when it already
+// exists. When no administrator password is given in the config or the
+// SqlAdministratorPasswordEnv environment variable a strong password is
+// generated and written to the AdministratorPasswordSink, which defaults to a
+// file in the working directory.
+//
+// On an existing server PublicNetworkAccess and MinimalTLSVersion are only
+// changed when they are set, and firewall and virtual network rules that are
+// not in the config are only deleted when the server is owned by the stack or
+// PruneNetworkRules is set.
+//
+// The EntraAdmin is set as the Microsoft Entra ID administrator of the server
+// and EntraOnlyAuthentication disables SQL authentication, in which case no
+// administrator password is set. Azure SQL identifies a ServicePrincipal
+// admin by its application (client) id, so for those the ObjectID of the
+// EntraAdmin must be the application id.
+type AzureSqlConfig struct {
+	AzureResourceConfig       `yaml:",inline"`
+	ServerName                *string                   `yaml:"ServerName"`
+	AdministratorLogin        *string                   `yaml:"AdministratorLogin"`
+	AdministratorPassword     *string                   `yaml:"AdministratorPassword"`
+	AdministratorPasswordSink *SecretSinkConfig         `yaml:"AdministratorPasswordSink"`
+	CustomerManagedKey        *CustomerManagedKeyConfig `yaml:"CustomerManagedKey"`
+	PublicNetworkAccess       *bool                     `yaml:"PublicNetworkAccess"`
+	MinimalTLSVersion         *string                   `yaml:"MinimalTLSVersion"`
+	AllowAzureServices        *bool                     `yaml:"AllowAzureServices"`
+	PruneNetworkRules         *bool                     `yaml:"PruneNetworkRules"`
+	EntraAdmin                *EntraAdminConfig         `yaml:"EntraAdmin"`
+	EntraOnlyAuthentication   *bool                     `yaml:"EntraOnlyAuthentication"`
+	Identity                  *SqlServerIdentityConfig  `yaml:"Identity"`
+
+	Databases           []*SqlDatabaseConfig           `yaml:"Databases"`
+	FirewallRules       []*FirewallRuleConfig          `yaml:"FirewallRules"`
+	VirtualNetworkRules []*SqlVirtualNetworkRuleConfig `yaml:"VirtualNetworkRules"`
+}
+
+// SqlServerIdentityConfig assigns managed identities to the server. When more
+// than one user-assigned identity is attached the primary one has to be
+// named, it is used by the server to reach Microsoft Entra ID and Key Vault.
+// The identity of a CustomerManagedKey is always attached and is the primary
+// identity.
+type SqlServerIdentityConfig struct {
+	SystemAssigned                *bool    `yaml:"SystemAssigned"`
+	UserAssignedIdentityIDs       []string `yaml:"UserAssignedIdentityIDs"`
+	PrimaryUserAssignedIdentityID *string  `yaml:"PrimaryUserAssignedIdentityID"`
+}
+
+// SqlVirtualNetworkRuleConfig allows connections to the server from a
+// subnet. The subnet needs the Microsoft.Sql service endpoint unless
+// IgnoreMissingServiceEndpoint is set, in which case the rule is created but
+// only takes effect once the endpoint is enabled.
+type SqlVirtualNetworkRuleConfig struct {
+	Name                         *string `yaml:"Name"`
+	SubnetID                     *string `yaml:"SubnetID"`
+	IgnoreMissingServiceEndpoint *bool   `yaml:"IgnoreMissingServiceEndpoint"`
+}
+
+// SqlDatabaseConfig describes a database on the Azure SQL server. SKUName is
+// either a DTU service objective such as Basic, S0 or P1, or a vCore edition
+// such as GP_Gen5, BC_Gen5 or HS_Gen5 with Capacity vCores. Serverless
+// editions such as GP_S_Gen5 scale between MinCapacity and Capacity vCores and
+// pause after AutoPauseDelayMinutes without activity, -1 disables auto-pause.
+// MaxSizeGB, Collation and BackupStorageRedundancy default to the Azure
+// defaults.
+type SqlDatabaseConfig struct {
+	Name                    *string  `yaml:"Name"`
+	SKUName                 *string  `yaml:"SKUName"`
+	Capacity                *int32   `yaml:"Capacity"`
+	MinCapacity             *float64 `yaml:"MinCapacity"`
+	AutoPauseDelayMinutes   *int32   `yaml:"AutoPauseDelayMinutes"`
+	MaxSizeGB               *int64   `yaml:"MaxSizeGB"`
+	Collation               *string  `yaml:"Collation"`
+	ZoneRedundant           *bool    `yaml:"ZoneRedundant"`
+	BackupStorageRedundancy *string  `yaml:"BackupStorageRedundancy"`
+}
+
+func (config *AzureSqlConfig) Validate() error {
+	if err := config.AzureResourceConfig.ValidateNotNull(); err != nil {
+		return err
+	}
+
+	if !sqlServerNameRegexp.MatchString(config.GetServerName()) {
+		return fmt.Errorf("server name %s must be 1 to 63 lowercase letters, numbers and hyphens", config.GetServerName())
+	}
+
+	login := config.GetAdministratorLogin()
+	if !sqlAdministratorLoginRegexp.MatchString(login) {
+		return fmt.Errorf("AdministratorLogin %s must start with a letter and contain only letters, numbers and underscores", login)
+	}
+
+	if reservedSqlAdministratorLogins[strings.ToLower(login)] {
+		return fmt.Errorf("AdministratorLogin %s is a reserved name", login)
+	}
+
+	if config.GetEntraOnlyAuthentication() {
+		if config.EntraAdmin == nil {
+			return fmt.Errorf("an EntraAdmin is required when EntraOnlyAuthentication is enabled")
+		}
+
+		if config.AdministratorPassword != nil || config.AdministratorPasswordSink != nil {
+			return fmt.Errorf("AdministratorPassword and AdministratorPasswordSink cannot be used with EntraOnlyAuthentication")
+		}
+	} else if password, ok := config.GetAdministratorPassword(); ok {
+		if err := ValidateSqlAdministratorPassword(login, password); err != nil {
+			return err
+		}
+	}
+
+	if config.EntraAdmin != nil {
+		if err := config.EntraAdmin.Validate(); err != nil {
+			return fmt.Errorf("could not validate entra admin: %w", err)
+		}
+	}
+
+	if config.Identity != nil {
+		if err := config.Identity.Validate(config.CustomerManagedKey != nil); err != nil {
+			return fmt.Errorf("could not validate server identity: %w", err)
+		}
+	}
+
+	if config.AdministratorPasswordSink != nil {
+		if err := config.AdministratorPasswordSink.Validate(); err != nil {
+			return fmt.Errorf("could not validate administrator password sink: %w", err)
+		}
+	}
+
+	if config.CustomerManagedKey != nil {
+		if err := config.CustomerManagedKey.Validate(); err != nil {
+			return fmt.Errorf("could not validate customer managed key: %w", err)
+		}
+	}
+
+	switch config.GetMinimalTLSVersion() {
+	case SqlMinimalTLSVersion10, SqlMinimalTLSVersion11, SqlMinimalTLSVersion12, SqlMinimalTLSVersion13:
+	default:
+		return fmt.Errorf("unsupported MinimalTLSVersion %s", config.GetMinimalTLSVersion())
+	}
+
+	// firewall rules only apply to the public endpoint and cannot be managed
+	// while it is disabled
+	if !config.GetPublicNetworkAccess() && (len(config.FirewallRules) > 0 || config.GetAllowAzureServices()) {
+		return fmt.Errorf("FirewallRules and AllowAzureServices require PublicNetworkAccess")
+	}
+
+	if err := validateFirewallRules(config.FirewallRules); err != nil {
+		return err
+	}
+
+	for _, rule := range config.FirewallRules {
+		if *rule.Name == SqlAllowAzureServicesRuleName {
+			return fmt.Errorf("firewall rule name %s is reserved, set AllowAzureServices instead", SqlAllowAzureServicesRuleName)
+		}
+	}
+
+	ruleNames := make(map[string]bool)
+	for _, rule := range config.VirtualNetworkRules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+
+		if ruleNames[*rule.Name] {
+			return fmt.Errorf("virtual network rule name %s is used more than once", *rule.Name)
+		}
+		ruleNames[*rule.Name] = true
+	}
+
+	databaseNames := make(map[string]bool)
+	for _, database := range config.GetDatabases() {
+		if err := database.Validate(); err != nil {
+			return err
+		}
+
+		if databaseNames[strings.ToLower(*database.Name)] {
+			return fmt.Errorf("database name %s is used more than once", *database.Name)
+		}
+		databaseNames[strings.ToLower(*database.Name)] = true
+	}
+
+	return nil
+}
+
+func (config *AzureSqlConfig) GetServerName() string {
+	if config.ServerName == nil {
+		return *config.Name
+	}
+
+	return *config.ServerName
+}
+
+// GetEntraOnlyAuthentication returns whether SQL authentication is disabled,
+// which defaults to false.
+func (config *AzureSqlConfig) GetEntraOnlyAuthentication() bool {
+	if config.EntraOnlyAuthentication == nil {
+		return false
+	}
+
+	return *config.EntraOnlyAuthentication
+}
+
+// GetPublicNetworkAccess returns whether the public endpoint of the server is
+// enabled, which defaults to true.
+func (config *AzureSqlConfig) GetPublicNetworkAccess() bool {
+	if config.PublicNetworkAccess == nil {
+		return true
+	}
+
+	return *config.PublicNetworkAccess
+}
+
+func (config *AzureSqlConfig) GetMinimalTLSVersion() string {
+	if config.MinimalTLSVersion == nil {
+		return SqlMinimalTLSVersion12
+	}
+
+	return *config.MinimalTLSVersion
+}
+
+func (config *AzureSqlConfig) GetAllowAzureServices() bool {
+	if config.AllowAzureServices == nil {
+		return false
+	}
+
+	return *config.AllowAzureServices
+}
+
+// GetPruneNetworkRules returns whether firewall and virtual network rules
+// that are not in the config are deleted from a server the stack does not
+// own, which defaults to false.
+func (config *AzureSqlConfig) GetPruneNetworkRules() bool {
+	if config.PruneNetworkRules == nil {
+		return false
+	}
+
+	return *config.PruneNetworkRules
+}
+
+// GetFirewallRules returns the declared firewall rules, including the rule
+// that allows Azure services when AllowAzureServices is set.
+func (config *AzureSqlConfig) GetFirewallRules() []*FirewallRuleConfig {
+	firewallRules := append([]*FirewallRuleConfig{}, config.FirewallRules...)
+	if config.GetAllowAzureServices() {
+		firewallRules = append(firewallRules, &FirewallRuleConfig{
+			Name:           to.Ptr(SqlAllowAzureServicesRuleName),
+			StartIPAddress: to.Ptr("0.0.0.0"),
+			EndIPAddress:   to.Ptr("0.0.0.0"),
+		})
+	}
+
+	return firewallRules
+}
+
+// GetDatabases returns the databases to create, defaulting to a single
+// database named after the server.
+func (config *AzureSqlConfig) GetDatabases() []*SqlDatabaseConfig {
+	if len(config.Databases) == 0 {
+		serverName := config.GetServerName()
+		return []*SqlDatabaseConfig{{Name: &serverName}}
+	}
+
+	return config.Databases
+}
+
+func (config *AzureSqlConfig) GetAdministratorLogin() string {
+	if config.AdministratorLogin == nil {
+		return defaultSqlAdministratorLogin
+	}
+
+	return *config.AdministratorLogin
+}
+
+// GetAdministratorPassword returns the administrator password from the config,
+// falling back to the SqlAdministratorPasswordEnv environment variable. It
+// returns false when neither is set and a password has to be generated.
+func (config *AzureSqlConfig) GetAdministratorPassword() (string, bool) {
+	return administratorPassword(config.AdministratorPassword, SqlAdministratorPasswordEnv)
+}
+
+// GetAdministratorPasswordSink returns where the administrator password is
+// written to, defaulting to a file sink.
+func (config *AzureSqlConfig) GetAdministratorPasswordSink() *SecretSinkConfig {
+	if config.AdministratorPasswordSink == nil {
+		return &SecretSinkConfig{}
+	}
+
+	return config.AdministratorPasswordSink
+}
+
+// ValidateSqlAdministratorPassword checks the password against the Azure SQL
+// complexity rules: 8 to 128 characters from at least three of the uppercase,
+// lowercase, digit and symbol classes, not containing the login name.
+func ValidateSqlAdministratorPassword(login string, password string) error {
+	if len(password) < 8 || len(password) > 128 {
+		return fmt.Errorf("administrator password must be 8 to 128 characters long")
+	}
+
+	if strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		return fmt.Errorf("administrator password must not contain the login name")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, character := range password {
+		switch {
+		case unicode.IsUpper(character):
+			upper = true
+		case unicode.IsLower(character):
+			lower = true
+		case unicode.IsDigit(character):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{upper, lower, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+
+	if classes < 3 {
+		return fmt.Errorf("administrator password must contain characters from three of the uppercase, lowercase, digit and symbol classes")
+	}
+
+	return nil
+}
+
+// Validate checks the identities. The primary identity can be left out when a
+// customer-managed key provides it.
+func (identity *SqlServerIdentityConfig) Validate(hasCustomerManagedKey bool) error {
+	identityIDs := make(map[string]bool)
+	for _, identityID := range identity.UserAssignedIdentityIDs {
+		resourceID, err := arm.ParseResourceID(identityID)
+		if err != nil {
+			return fmt.Errorf("could not parse user-assigned identity id %s: %w", identityID, err)
+		}
+
+		if !strings.EqualFold(resourceID.ResourceType.String(), "Microsoft.ManagedIdentity/userAssignedIdentities") {
+			return fmt.Errorf("%s is not a user-assigned managed identity", identityID)
+		}
+
+		identityIDs[strings.ToLower(identityID)] = true
+	}
+
+	if identity.PrimaryUserAssignedIdentityID != nil {
+		if hasCustomerManagedKey {
+			return fmt.Errorf("PrimaryUserAssignedIdentityID cannot be set with a CustomerManagedKey, its identity is the primary identity")
+		}
+
+		if !identityIDs[strings.ToLower(*identity.PrimaryUserAssignedIdentityID)] {
+			return fmt.Errorf("PrimaryUserAssignedIdentityID %s is not in UserAssignedIdentityIDs", *identity.PrimaryUserAssignedIdentityID)
+		}
+	} else if len(identityIDs) > 1 && !hasCustomerManagedKey {
+		return fmt.Errorf("PrimaryUserAssignedIdentityID is required when more than one user-assigned identity is attached")
+	}
+
+	return nil
+}
+
+func (identity *SqlServerIdentityConfig) GetSystemAssigned() bool {
+	if identity.SystemAssigned == nil {
+		return false
+	}
+
+	return *identity.SystemAssigned
+}
+
+func (rule *SqlVirtualNetworkRuleConfig) Validate() error {
+	if rule.Name == nil {
+		return fmt.Errorf("could not find Name for virtual network rule")
+	}
+
+	if !firewallRuleNameRegexp.MatchString(*rule.Name) {
+		return fmt.Errorf("virtual network rule name %s must be 1 to 128 letters, numbers, underscores and hyphens", *rule.Name)
+	}
+
+	if rule.SubnetID == nil {
+		return fmt.Errorf("could not find SubnetID for virtual network rule %s", *rule.Name)
+	}
+
+	subnetID, err := arm.ParseResourceID(*rule.SubnetID)
+	if err != nil {
+		return fmt.Errorf("could not parse SubnetID %s: %w", *rule.SubnetID, err)
+	}
+
+	if !strings.EqualFold(subnetID.ResourceType.String(), "Microsoft.Network/virtualNetworks/subnets") {
+		return fmt.Errorf("SubnetID %s of virtual network rule %s is not a subnet", *rule.SubnetID, *rule.Name)
+	}
+
+	return nil
+}
+
+func (rule *SqlVirtualNetworkRuleConfig) GetIgnoreMissingServiceEndpoint() bool {
+	if rule.IgnoreMissingServiceEndpoint == nil {
+		return false
+	}
+
+	return *rule.IgnoreMissingServiceEndpoint
+}
+
+func (database *SqlDatabaseConfig) Validate() error {
+	if database.Name == nil {
+		return fmt.Errorf("could not find Name for database")
+	}
+
+	if !sqlDatabaseNameRegexp.MatchString(*database.Name) {
+		return fmt.Errorf("database name %s must be 1 to 128 characters without <>*%%&:\\/? and must not end with a period or space", *database.Name)
+	}
+
+	switch strings.ToLower(*database.Name) {
+	case "master", "model", "msdb", "tempdb":
+		return fmt.Errorf("database name %s is reserved", *database.Name)
+	}
+
+	if database.IsDTU() {
+		if database.Capacity != nil {
+			return fmt.Errorf("Capacity of database %s is set by DTU SKU %s", *database.Name, database.GetSKUName())
+		}
+
+		// only the Premium DTU tiers support zone redundancy
+		if !strings.HasPrefix(database.GetSKUName(), "P") && database.GetZoneRedundant() {
+			return fmt.Errorf("ZoneRedundant of database %s is not available with DTU SKU %s", *database.Name, database.GetSKUName())
+		}
+	} else if database.GetCapacity() < 1 {
+		return fmt.Errorf("Capacity of database %s must be at least 1 vCore, got %d", *database.Name, database.GetCapacity())
+	}
+
+	if database.IsServerless() {
+		if database.GetMinCapacity() <= 0 || database.GetMinCapacity() > float64(database.GetCapacity()) {
+			return fmt.Errorf("MinCapacity of database %s must be greater than 0 and at most Capacity %d", *database.Name, database.GetCapacity())
+		}
+
+		autoPause := database.GetAutoPauseDelayMinutes()
+		if autoPause != -1 && (autoPause < 15 || autoPause > 10080) {
+			return fmt.Errorf("AutoPauseDelayMinutes of database %s must be -1 or between 15 and 10080, got %d", *database.Name, autoPause)
+		}
+	} else if database.MinCapacity != nil || database.AutoPauseDelayMinutes != nil {
+		return fmt.Errorf("MinCapacity and AutoPauseDelayMinutes of database %s require a serverless SKU such as GP_S_Gen5", *database.Name)
+	}
+
+	if database.MaxSizeGB != nil && *database.MaxSizeGB < 1 {
+		return fmt.Errorf("MaxSizeGB of database %s must be at least 1, got %d", *database.Name, *database.MaxSizeGB)
+	}
+
+	if database.BackupStorageRedundancy != nil {
+		switch *database.BackupStorageRedundancy {
+		case SqlBackupStorageRedundancyLocal, SqlBackupStorageRedundancyZone,
+			SqlBackupStorageRedundancyGeo, SqlBackupStorageRedundancyGeoZone:
+		default:
+			return fmt.Errorf("unsupported BackupStorageRedundancy %s for database %s", *database.BackupStorageRedundancy, *database.Name)
+		}
+	}
+
+	return nil
+}
+
+func (database *SqlDatabaseConfig) GetSKUName() string {
+	if database.SKUName == nil {
+		return defaultSqlDatabaseSKUName
+	}
+
+	return *database.SKUName
+}
+
+// IsDTU returns true when the SKU is a DTU service objective rather than a
+// vCore edition.
+func (database *SqlDatabaseConfig) IsDTU() bool {
+	return sqlDTUSKUNameRegexp.MatchString(database.GetSKUName())
+}
+
+// IsServerless returns true for serverless vCore editions such as GP_S_Gen5.
+func (database *SqlDatabaseConfig) IsServerless() bool {
+	return strings.Contains(database.GetSKUName(), "_S_")
+}
+
+// GetCapacity returns the number of vCores, or the maximum number of vCores
+// of a serverless database.
+func (database *SqlDatabaseConfig) GetCapacity() int32 {
+	if database.Capacity == nil {
+		return defaultSqlDatabaseCapacity
+	}
+
+	return *database.Capacity
+}
+
+func (database *SqlDatabaseConfig) GetMinCapacity() float64 {
+	if database.MinCapacity == nil {
+		return defaultSqlDatabaseMinCapacity
+	}
+
+	return *database.MinCapacity
+}
+
+func (database *SqlDatabaseConfig) GetAutoPauseDelayMinutes() int32 {
+	if database.AutoPauseDelayMinutes == nil {
+		return defaultSqlDatabaseAutoPauseMinutes
+	}
+
+	return *database.AutoPauseDelayMinutes
+}
+
+func (database *SqlDatabaseConfig) GetZoneRedundant() bool {
+	if database.ZoneRedundant == nil {
+		return false
+	}
+
+	return *database.ZoneRedundant
+}
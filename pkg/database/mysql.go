@@ -1 +1,401 @@
 package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/mysql/armmysqlflexibleservers"
+	"github.com/nukleros/azure-builder/pkg/config"
+	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+// MySqlServer is the output of a mysql stack: the flexible server and the
+// databases and firewall rules declared in the mysql config. ServerShared is
+// set when the server already existed and is not in a resource group
+// azure-builder created for this stack, in which case the server is not part
+// of the stack.
+type MySqlServer struct {
+	ServerShared  bool                                    `json:"serverShared"`
+	Server        *armmysqlflexibleservers.Server         `json:"server"`
+	Databases     []*armmysqlflexibleservers.Database     `json:"databases,omitempty"`
+	FirewallRules []*armmysqlflexibleservers.FirewallRule `json:"firewallRules,omitempty"`
+}
+
+// CreateMySqlServer creates the mysql flexible server with its databases
+// and firewall rules. Once the resource group exists the server is returned
+// also when a later step fails, with Server nil when it was not created.
+func CreateMySqlServer(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	session *config.AzureSession,
+) (*MySqlServer, error) {
+	if err := mysqlConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate mysql config: %w", err)
+	}
+
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&mysqlConfig.AzureResourceConfig, session, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the resource group: %w", err)
+	}
+	log.Println("resources group:", *resourceGroup.ID)
+
+	mysqlServer := &MySqlServer{}
+
+	server, serverExisted, err := createMySqlFlexibleServer(ctx, mysqlConfig, session)
+	if err != nil {
+		return mysqlServer, fmt.Errorf("could not create mysql flexible server: %w", err)
+	}
+	mysqlServer.Server = server
+	mysqlServer.ServerShared = serverExisted &&
+		resourcegroup.CheckOwnership(resourceGroup, mysqlConfig.GetStackName()) != nil
+	log.Println("mysql flexible server:", *server.ID)
+
+	if err := configureMySqlServerParameters(ctx, mysqlConfig, session); err != nil {
+		return mysqlServer, fmt.Errorf("could not configure mysql server parameters: %w", err)
+	}
+
+	for _, ruleConfig := range mysqlConfig.FirewallRules {
+		rule, err := createMySqlFirewallRule(ctx, mysqlConfig, ruleConfig, session)
+		if err != nil {
+			return mysqlServer, fmt.Errorf("could not create firewall rule %s: %w", *ruleConfig.Name, err)
+		}
+		log.Println("firewall rule:", *rule.ID)
+		mysqlServer.FirewallRules = append(mysqlServer.FirewallRules, rule)
+	}
+
+	for _, databaseConfig := range mysqlConfig.Databases {
+		database, err := createMySqlDatabase(ctx, mysqlConfig, databaseConfig, session)
+		if err != nil {
+			return mysqlServer, fmt.Errorf("could not create database %s: %w", *databaseConfig.Name, err)
+		}
+		log.Println("database:", *database.ID)
+		mysqlServer.Databases = append(mysqlServer.Databases, database)
+	}
+
+	return mysqlServer, nil
+}
+
+// GetMySqlServer returns the mysql flexible server with the databases and
+// firewall rules declared in the mysql config.
+func GetMySqlServer(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	session *config.AzureSession,
+) (*MySqlServer, error) {
+	serversClient, err := session.CreateMySqlServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql servers client from session: %w", err)
+	}
+
+	serverResp, err := serversClient.Get(ctx, *mysqlConfig.ResourceGroup, *mysqlConfig.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get mysql flexible server %s: %w", *mysqlConfig.Name, err)
+	}
+
+	mysqlServer := &MySqlServer{Server: &serverResp.Server}
+
+	firewallRulesClient, err := session.CreateMySqlFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql firewall rules client from session: %w", err)
+	}
+
+	for _, ruleConfig := range mysqlConfig.FirewallRules {
+		resp, err := firewallRulesClient.Get(ctx, *mysqlConfig.ResourceGroup, *mysqlConfig.Name, *ruleConfig.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get firewall rule %s: %w", *ruleConfig.Name, err)
+		}
+		mysqlServer.FirewallRules = append(mysqlServer.FirewallRules, &resp.FirewallRule)
+	}
+
+	databasesClient, err := session.CreateMySqlDatabasesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql databases client from session: %w", err)
+	}
+
+	for _, databaseConfig := range mysqlConfig.Databases {
+		resp, err := databasesClient.Get(ctx, *mysqlConfig.ResourceGroup, *mysqlConfig.Name, *databaseConfig.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get database %s: %w", *databaseConfig.Name, err)
+		}
+		mysqlServer.Databases = append(mysqlServer.Databases, &resp.Database)
+	}
+
+	return mysqlServer, nil
+}
+
+// createMySqlFlexibleServer creates the server unless it already exists. The
+// returned flag is set when the server already existed.
+func createMySqlFlexibleServer(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	session *config.AzureSession,
+) (*armmysqlflexibleservers.Server, bool, error) {
+	serversClient, err := session.CreateMySqlServersClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create mysql servers client from session: %w", err)
+	}
+
+	// databases, firewall rules and server parameters of an existing server
+	// are still reconciled, the server itself is left untouched
+	existingServer, err := serversClient.Get(ctx, *mysqlConfig.ResourceGroup, *mysqlConfig.Name, nil)
+	if err == nil {
+		log.Printf("mysql flexible server %s already exists", *mysqlConfig.Name)
+		return &existingServer.Server, true, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, false, fmt.Errorf("could not check for existing mysql flexible server %s: %w", *mysqlConfig.Name, err)
+	}
+
+	administratorPassword, err := mysqlConfig.GetAdministratorPassword()
+	if err != nil {
+		return nil, false, err
+	}
+
+	geoRedundantBackup := armmysqlflexibleservers.EnableStatusEnumDisabled
+	if mysqlConfig.GetGeoRedundantBackup() {
+		geoRedundantBackup = armmysqlflexibleservers.EnableStatusEnumEnabled
+	}
+
+	storageAutoGrow := armmysqlflexibleservers.EnableStatusEnumDisabled
+	if mysqlConfig.GetStorageAutoGrow() {
+		storageAutoGrow = armmysqlflexibleservers.EnableStatusEnumEnabled
+	}
+
+	highAvailability := &armmysqlflexibleservers.HighAvailability{
+		Mode: to.Ptr(armmysqlflexibleservers.HighAvailabilityMode(mysqlConfig.GetHighAvailabilityMode())),
+	}
+	if mysqlConfig.GetHighAvailabilityMode() == config.MySqlHighAvailabilityZoneRedundant {
+		highAvailability.StandbyAvailabilityZone = mysqlConfig.StandbyAvailabilityZone
+	}
+
+	pollerResp, err := serversClient.BeginCreate(
+		ctx,
+		*mysqlConfig.ResourceGroup,
+		*mysqlConfig.Name,
+		armmysqlflexibleservers.Server{
+			Location: mysqlConfig.Region,
+			SKU: &armmysqlflexibleservers.SKU{
+				Name: to.Ptr(mysqlConfig.GetSKUName()),
+				Tier: to.Ptr(armmysqlflexibleservers.SKUTier(mysqlConfig.GetSKUTier())),
+			},
+			Properties: &armmysqlflexibleservers.ServerProperties{
+				AdministratorLogin:         to.Ptr(mysqlConfig.GetAdministratorLogin()),
+				AdministratorLoginPassword: to.Ptr(administratorPassword),
+				Version:                    to.Ptr(armmysqlflexibleservers.ServerVersion(mysqlConfig.GetVersion())),
+				AvailabilityZone:           mysqlConfig.AvailabilityZone,
+				CreateMode:                 to.Ptr(armmysqlflexibleservers.CreateModeDefault),
+				Storage: &armmysqlflexibleservers.Storage{
+					StorageSizeGB: to.Ptr(mysqlConfig.GetStorageSizeGB()),
+					AutoGrow:      to.Ptr(storageAutoGrow),
+				},
+				Backup: &armmysqlflexibleservers.Backup{
+					BackupRetentionDays: to.Ptr(mysqlConfig.GetBackupRetentionDays()),
+					GeoRedundantBackup:  to.Ptr(geoRedundantBackup),
+				},
+				HighAvailability: highAvailability,
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return &resp.Server, false, nil
+}
+
+// configureMySqlServerParameters sets the server parameters in the mysql
+// config in a single batch. Parameters that are not in the config keep their
+// current values.
+func configureMySqlServerParameters(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	session *config.AzureSession,
+) error {
+	if len(mysqlConfig.ServerParameters) == 0 {
+		return nil
+	}
+
+	configurationsClient, err := session.CreateMySqlConfigurationsClient()
+	if err != nil {
+		return fmt.Errorf("could not create mysql configurations client from session: %w", err)
+	}
+
+	names := make([]string, 0, len(mysqlConfig.ServerParameters))
+	for name := range mysqlConfig.ServerParameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parameters []*armmysqlflexibleservers.ConfigurationForBatchUpdate
+	for _, name := range names {
+		parameters = append(parameters, &armmysqlflexibleservers.ConfigurationForBatchUpdate{
+			Name: to.Ptr(name),
+			Properties: &armmysqlflexibleservers.ConfigurationForBatchUpdateProperties{
+				Value:  to.Ptr(mysqlConfig.ServerParameters[name]),
+				Source: to.Ptr("user-override"),
+			},
+		})
+	}
+
+	pollerResp, err := configurationsClient.BeginBatchUpdate(
+		ctx,
+		*mysqlConfig.ResourceGroup,
+		*mysqlConfig.Name,
+		armmysqlflexibleservers.ConfigurationListForBatchUpdate{Value: parameters},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run BatchUpdate for server parameters: %w", err)
+	}
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run BatchUpdate for server parameters: %w", err)
+	}
+
+	log.Printf("configured %d server parameters on mysql flexible server %s", len(parameters), *mysqlConfig.Name)
+
+	return nil
+}
+
+func createMySqlFirewallRule(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	ruleConfig *config.FirewallRuleConfig,
+	session *config.AzureSession,
+) (*armmysqlflexibleservers.FirewallRule, error) {
+	firewallRulesClient, err := session.CreateMySqlFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql firewall rules client from session: %w", err)
+	}
+
+	pollerResp, err := firewallRulesClient.BeginCreateOrUpdate(
+		ctx,
+		*mysqlConfig.ResourceGroup,
+		*mysqlConfig.Name,
+		*ruleConfig.Name,
+		armmysqlflexibleservers.FirewallRule{
+			Properties: &armmysqlflexibleservers.FirewallRuleProperties{
+				StartIPAddress: ruleConfig.StartIPAddress,
+				EndIPAddress:   ruleConfig.EndIPAddress,
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.FirewallRule, nil
+}
+
+func createMySqlDatabase(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	databaseConfig *config.MySqlDatabaseConfig,
+	session *config.AzureSession,
+) (*armmysqlflexibleservers.Database, error) {
+	databasesClient, err := session.CreateMySqlDatabasesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql databases client from session: %w", err)
+	}
+
+	pollerResp, err := databasesClient.BeginCreateOrUpdate(
+		ctx,
+		*mysqlConfig.ResourceGroup,
+		*mysqlConfig.Name,
+		*databaseConfig.Name,
+		armmysqlflexibleservers.Database{
+			Properties: &armmysqlflexibleservers.DatabaseProperties{
+				Charset:   databaseConfig.Charset,
+				Collation: databaseConfig.Collation,
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Database, nil
+}
+
+// DeleteMode controls how much of a database stack is removed on delete.
+type DeleteMode int
+
+const (
+	// DeleteModeResourceGroup deletes the entire resource group the server
+	// was provisioned in.
+	DeleteModeResourceGroup DeleteMode = iota
+
+	// DeleteModeServerOnly deletes the server and only deletes its resource
+	// group when azure-builder created it and nothing else is left in it.
+	DeleteModeServerOnly
+)
+
+func DeleteMySqlServer(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	session *config.AzureSession,
+	deleteMode DeleteMode,
+	force bool,
+) error {
+	if deleteMode == DeleteModeServerOnly {
+		if err := deleteMySqlFlexibleServer(ctx, mysqlConfig, session); err != nil {
+			return fmt.Errorf("could not delete the mysql flexible server: %w", err)
+		}
+
+		if err := resourcegroup.CleanupEmptyResourceGroup(&mysqlConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the mysql flexible server: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := resourcegroup.CleanupResourceGroup(&mysqlConfig.AzureResourceConfig, session, ctx, force); err != nil {
+		return fmt.Errorf("could not clean up resource group for the mysql flexible server: %w", err)
+	}
+
+	return nil
+}
+
+func deleteMySqlFlexibleServer(
+	ctx context.Context,
+	mysqlConfig *config.AzureMySqlConfig,
+	session *config.AzureSession,
+) error {
+	serversClient, err := session.CreateMySqlServersClient()
+	if err != nil {
+		return fmt.Errorf("could not create mysql servers client from session: %w", err)
+	}
+
+	log.Printf("deleting mysql flexible server %s...", *mysqlConfig.Name)
+	pollerResp, err := serversClient.BeginDelete(ctx, *mysqlConfig.ResourceGroup, *mysqlConfig.Name, nil)
+	if err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("mysql flexible server %s does not exist", *mysqlConfig.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to run Delete for mysql flexible server %s: %w", *mysqlConfig.Name, err)
+	}
+
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run Delete for mysql flexible server %s: %w", *mysqlConfig.Name, err)
+	}
+
+	log.Printf("deleted mysql flexible server %s", *mysqlConfig.Name)
+
+	return nil
+}
@@ -0,0 +1,533 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/postgresql/armpostgresqlflexibleservers/v4"
+	"github.com/nukleros/azure-builder/pkg/config"
+	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+// PostgresServer is the output of a postgres stack: the flexible server and
+// the databases and firewall rules declared in the postgres config.
+// ServerShared is set when the server already existed and is not in a
+// resource group azure-builder created for this stack, in which case the
+// server is not part of the stack.
+type PostgresServer struct {
+	ServerShared  bool                                         `json:"serverShared"`
+	Server        *armpostgresqlflexibleservers.Server         `json:"server"`
+	Databases     []*armpostgresqlflexibleservers.Database     `json:"databases,omitempty"`
+	FirewallRules []*armpostgresqlflexibleservers.FirewallRule `json:"firewallRules,omitempty"`
+}
+
+// CreatePostgresServer creates the postgres flexible server with its databases
+// and firewall rules. Once the resource group exists the server is returned
+// also when a later step fails, with Server nil when it was not created.
+func CreatePostgresServer(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+) (*PostgresServer, error) {
+	if err := postgresConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate postgres config: %w", err)
+	}
+
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&postgresConfig.AzureResourceConfig, session, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the resource group: %w", err)
+	}
+	log.Println("resources group:", *resourceGroup.ID)
+
+	postgresServer := &PostgresServer{}
+
+	server, serverExisted, err := createPostgresFlexibleServer(ctx, postgresConfig, session)
+	if err != nil {
+		return postgresServer, fmt.Errorf("could not create postgres flexible server: %w", err)
+	}
+	postgresServer.Server = server
+	postgresServer.ServerShared = serverExisted &&
+		resourcegroup.CheckOwnership(resourceGroup, postgresConfig.GetStackName()) != nil
+	log.Println("postgres flexible server:", *server.ID)
+
+	if err := configurePostgresServerParameters(ctx, postgresConfig, session); err != nil {
+		return postgresServer, fmt.Errorf("could not configure postgres server parameters: %w", err)
+	}
+
+	if postgresConfig.EntraAdmin != nil {
+		if err := enablePostgresEntraAuth(ctx, postgresConfig, server, session); err != nil {
+			return postgresServer, fmt.Errorf("could not enable entra authentication: %w", err)
+		}
+
+		if err := createPostgresEntraAdmin(ctx, postgresConfig, session); err != nil {
+			return postgresServer, fmt.Errorf("could not configure entra admin: %w", err)
+		}
+	}
+
+	for _, ruleConfig := range postgresConfig.FirewallRules {
+		rule, err := createPostgresFirewallRule(ctx, postgresConfig, ruleConfig, session)
+		if err != nil {
+			return postgresServer, fmt.Errorf("could not create firewall rule %s: %w", *ruleConfig.Name, err)
+		}
+		log.Println("firewall rule:", *rule.ID)
+		postgresServer.FirewallRules = append(postgresServer.FirewallRules, rule)
+	}
+
+	for _, databaseConfig := range postgresConfig.Databases {
+		database, err := createPostgresDatabase(ctx, postgresConfig, databaseConfig, session)
+		if err != nil {
+			return postgresServer, fmt.Errorf("could not create database %s: %w", *databaseConfig.Name, err)
+		}
+		log.Println("database:", *database.ID)
+		postgresServer.Databases = append(postgresServer.Databases, database)
+	}
+
+	return postgresServer, nil
+}
+
+// GetPostgresServer returns the postgres flexible server with the databases and
+// firewall rules declared in the postgres config.
+func GetPostgresServer(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+) (*PostgresServer, error) {
+	serversClient, err := session.CreatePostgresServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres servers client from session: %w", err)
+	}
+
+	serverResp, err := serversClient.Get(ctx, *postgresConfig.ResourceGroup, *postgresConfig.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get postgres flexible server %s: %w", *postgresConfig.Name, err)
+	}
+
+	postgresServer := &PostgresServer{Server: &serverResp.Server}
+
+	firewallRulesClient, err := session.CreatePostgresFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres firewall rules client from session: %w", err)
+	}
+
+	for _, ruleConfig := range postgresConfig.FirewallRules {
+		resp, err := firewallRulesClient.Get(ctx, *postgresConfig.ResourceGroup, *postgresConfig.Name, *ruleConfig.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get firewall rule %s: %w", *ruleConfig.Name, err)
+		}
+		postgresServer.FirewallRules = append(postgresServer.FirewallRules, &resp.FirewallRule)
+	}
+
+	databasesClient, err := session.CreatePostgresDatabasesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres databases client from session: %w", err)
+	}
+
+	for _, databaseConfig := range postgresConfig.Databases {
+		resp, err := databasesClient.Get(ctx, *postgresConfig.ResourceGroup, *postgresConfig.Name, *databaseConfig.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get database %s: %w", *databaseConfig.Name, err)
+		}
+		postgresServer.Databases = append(postgresServer.Databases, &resp.Database)
+	}
+
+	return postgresServer, nil
+}
+
+// createPostgresFlexibleServer creates the server unless it already exists.
+// The returned flag is set when the server already existed.
+func createPostgresFlexibleServer(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+) (*armpostgresqlflexibleservers.Server, bool, error) {
+	serversClient, err := session.CreatePostgresServersClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create postgres servers client from session: %w", err)
+	}
+
+	// databases, firewall rules, server parameters and the entra admin of an
+	// existing server are still reconciled, the server itself is left untouched
+	// apart from enabling entra authentication for the entra admin
+	existingServer, err := serversClient.Get(ctx, *postgresConfig.ResourceGroup, *postgresConfig.Name, nil)
+	if err == nil {
+		log.Printf("postgres flexible server %s already exists", *postgresConfig.Name)
+		return &existingServer.Server, true, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, false, fmt.Errorf("could not check for existing postgres flexible server %s: %w", *postgresConfig.Name, err)
+	}
+
+	geoRedundantBackup := armpostgresqlflexibleservers.GeoRedundantBackupEnumDisabled
+	if postgresConfig.GetGeoRedundantBackup() {
+		geoRedundantBackup = armpostgresqlflexibleservers.GeoRedundantBackupEnumEnabled
+	}
+
+	storageAutoGrow := armpostgresqlflexibleservers.StorageAutoGrowDisabled
+	if postgresConfig.GetStorageAutoGrow() {
+		storageAutoGrow = armpostgresqlflexibleservers.StorageAutoGrowEnabled
+	}
+
+	highAvailability := &armpostgresqlflexibleservers.HighAvailability{
+		Mode: to.Ptr(armpostgresqlflexibleservers.HighAvailabilityMode(postgresConfig.GetHighAvailabilityMode())),
+	}
+	if postgresConfig.GetHighAvailabilityMode() == config.PostgresHighAvailabilityZoneRedundant {
+		highAvailability.StandbyAvailabilityZone = postgresConfig.StandbyAvailabilityZone
+	}
+
+	properties := &armpostgresqlflexibleservers.ServerProperties{
+		Version:          to.Ptr(armpostgresqlflexibleservers.ServerVersion(postgresConfig.GetVersion())),
+		AvailabilityZone: postgresConfig.AvailabilityZone,
+		CreateMode:       to.Ptr(armpostgresqlflexibleservers.CreateModeCreate),
+		Storage: &armpostgresqlflexibleservers.Storage{
+			StorageSizeGB: to.Ptr(postgresConfig.GetStorageSizeGB()),
+			AutoGrow:      to.Ptr(storageAutoGrow),
+		},
+		Backup: &armpostgresqlflexibleservers.Backup{
+			BackupRetentionDays: to.Ptr(postgresConfig.GetBackupRetentionDays()),
+			GeoRedundantBackup:  to.Ptr(geoRedundantBackup),
+		},
+		HighAvailability: highAvailability,
+		AuthConfig: &armpostgresqlflexibleservers.AuthConfig{
+			PasswordAuth:        to.Ptr(armpostgresqlflexibleservers.PasswordAuthEnumDisabled),
+			ActiveDirectoryAuth: to.Ptr(armpostgresqlflexibleservers.ActiveDirectoryAuthEnumDisabled),
+		},
+	}
+
+	if postgresConfig.GetPasswordAuth() {
+		administratorPassword, err := postgresConfig.GetAdministratorPassword()
+		if err != nil {
+			return nil, false, err
+		}
+
+		properties.AdministratorLogin = to.Ptr(postgresConfig.GetAdministratorLogin())
+		properties.AdministratorLoginPassword = to.Ptr(administratorPassword)
+		properties.AuthConfig.PasswordAuth = to.Ptr(armpostgresqlflexibleservers.PasswordAuthEnumEnabled)
+	}
+
+	if postgresConfig.EntraAdmin != nil {
+		tenantID, err := postgresConfig.EntraAdmin.GetTenantID(session.CredentialsConfig)
+		if err != nil {
+			return nil, false, err
+		}
+
+		properties.AuthConfig.ActiveDirectoryAuth = to.Ptr(armpostgresqlflexibleservers.ActiveDirectoryAuthEnumEnabled)
+		properties.AuthConfig.TenantID = to.Ptr(tenantID)
+	}
+
+	if postgresConfig.Network != nil && postgresConfig.Network.DelegatedSubnetID != nil {
+		properties.Network = &armpostgresqlflexibleservers.Network{
+			DelegatedSubnetResourceID:   postgresConfig.Network.DelegatedSubnetID,
+			PrivateDNSZoneArmResourceID: postgresConfig.Network.PrivateDNSZoneID,
+		}
+	}
+
+	pollerResp, err := serversClient.BeginCreate(
+		ctx,
+		*postgresConfig.ResourceGroup,
+		*postgresConfig.Name,
+		armpostgresqlflexibleservers.Server{
+			Location: postgresConfig.Region,
+			SKU: &armpostgresqlflexibleservers.SKU{
+				Name: to.Ptr(postgresConfig.GetSKUName()),
+				Tier: to.Ptr(armpostgresqlflexibleservers.SKUTier(postgresConfig.GetSKUTier())),
+			},
+			Properties: properties,
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return &resp.Server, false, nil
+}
+
+// configurePostgresServerParameters sets the server parameters and extension
+// allow-list in the postgres config one at a time, since flexible servers
+// have no batch update. Parameters that are not in the config keep their
+// current values.
+func configurePostgresServerParameters(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+) error {
+	parameters := postgresConfig.GetServerParameters()
+	if len(parameters) == 0 {
+		return nil
+	}
+
+	configurationsClient, err := session.CreatePostgresConfigurationsClient()
+	if err != nil {
+		return fmt.Errorf("could not create postgres configurations client from session: %w", err)
+	}
+
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pollerResp, err := configurationsClient.BeginUpdate(
+			ctx,
+			*postgresConfig.ResourceGroup,
+			*postgresConfig.Name,
+			name,
+			armpostgresqlflexibleservers.ConfigurationForUpdate{
+				Properties: &armpostgresqlflexibleservers.ConfigurationProperties{
+					Value:  to.Ptr(parameters[name]),
+					Source: to.Ptr("user-override"),
+				},
+			},
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to run Update for server parameter %s: %w", name, err)
+		}
+		resp, err := pollerResp.PollUntilDone(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to run Update for server parameter %s: %w", name, err)
+		}
+
+		if resp.Properties != nil && resp.Properties.IsConfigPendingRestart != nil && *resp.Properties.IsConfigPendingRestart {
+			log.Printf("server parameter %s takes effect after postgres flexible server %s is restarted", name, *postgresConfig.Name)
+		}
+	}
+
+	log.Printf("configured %d server parameters on postgres flexible server %s", len(names), *postgresConfig.Name)
+
+	return nil
+}
+
+// enablePostgresEntraAuth turns on Entra authentication on a server that
+// already existed without it, as an Entra admin cannot sign in otherwise.
+// Password authentication is left as it is.
+func enablePostgresEntraAuth(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	server *armpostgresqlflexibleservers.Server,
+	session *config.AzureSession,
+) error {
+	authConfig := &armpostgresqlflexibleservers.AuthConfig{}
+	if server.Properties != nil && server.Properties.AuthConfig != nil {
+		authConfig = server.Properties.AuthConfig
+	}
+
+	if authConfig.ActiveDirectoryAuth != nil &&
+		*authConfig.ActiveDirectoryAuth == armpostgresqlflexibleservers.ActiveDirectoryAuthEnumEnabled {
+		return nil
+	}
+
+	tenantID, err := postgresConfig.EntraAdmin.GetTenantID(session.CredentialsConfig)
+	if err != nil {
+		return err
+	}
+
+	passwordAuth := armpostgresqlflexibleservers.PasswordAuthEnumEnabled
+	if authConfig.PasswordAuth != nil {
+		passwordAuth = *authConfig.PasswordAuth
+	}
+
+	serversClient, err := session.CreatePostgresServersClient()
+	if err != nil {
+		return fmt.Errorf("could not create postgres servers client from session: %w", err)
+	}
+
+	pollerResp, err := serversClient.BeginUpdate(
+		ctx,
+		*postgresConfig.ResourceGroup,
+		*postgresConfig.Name,
+		armpostgresqlflexibleservers.ServerForUpdate{
+			Properties: &armpostgresqlflexibleservers.ServerPropertiesForUpdate{
+				AuthConfig: &armpostgresqlflexibleservers.AuthConfig{
+					ActiveDirectoryAuth: to.Ptr(armpostgresqlflexibleservers.ActiveDirectoryAuthEnumEnabled),
+					PasswordAuth:        to.Ptr(passwordAuth),
+					TenantID:            to.Ptr(tenantID),
+				},
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run Update for postgres flexible server %s: %w", *postgresConfig.Name, err)
+	}
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run Update for postgres flexible server %s: %w", *postgresConfig.Name, err)
+	}
+
+	log.Printf("enabled entra authentication on postgres flexible server %s", *postgresConfig.Name)
+
+	return nil
+}
+
+func createPostgresEntraAdmin(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+) error {
+	administratorsClient, err := session.CreatePostgresAdministratorsClient()
+	if err != nil {
+		return fmt.Errorf("could not create postgres administrators client from session: %w", err)
+	}
+
+	entraAdmin := postgresConfig.EntraAdmin
+	tenantID, err := entraAdmin.GetTenantID(session.CredentialsConfig)
+	if err != nil {
+		return err
+	}
+
+	pollerResp, err := administratorsClient.BeginCreate(
+		ctx,
+		*postgresConfig.ResourceGroup,
+		*postgresConfig.Name,
+		*entraAdmin.ObjectID,
+		armpostgresqlflexibleservers.ActiveDirectoryAdministratorAdd{
+			Properties: &armpostgresqlflexibleservers.AdministratorPropertiesForAdd{
+				PrincipalName: entraAdmin.PrincipalName,
+				PrincipalType: to.Ptr(armpostgresqlflexibleservers.PrincipalType(entraAdmin.GetPrincipalType())),
+				TenantID:      to.Ptr(tenantID),
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run Create for entra admin %s: %w", *entraAdmin.PrincipalName, err)
+	}
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run Create for entra admin %s: %w", *entraAdmin.PrincipalName, err)
+	}
+
+	log.Printf("set entra admin of postgres flexible server %s to %s", *postgresConfig.Name, *entraAdmin.PrincipalName)
+
+	return nil
+}
+
+func createPostgresFirewallRule(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	ruleConfig *config.FirewallRuleConfig,
+	session *config.AzureSession,
+) (*armpostgresqlflexibleservers.FirewallRule, error) {
+	firewallRulesClient, err := session.CreatePostgresFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres firewall rules client from session: %w", err)
+	}
+
+	pollerResp, err := firewallRulesClient.BeginCreateOrUpdate(
+		ctx,
+		*postgresConfig.ResourceGroup,
+		*postgresConfig.Name,
+		*ruleConfig.Name,
+		armpostgresqlflexibleservers.FirewallRule{
+			Properties: &armpostgresqlflexibleservers.FirewallRuleProperties{
+				StartIPAddress: ruleConfig.StartIPAddress,
+				EndIPAddress:   ruleConfig.EndIPAddress,
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.FirewallRule, nil
+}
+
+func createPostgresDatabase(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	databaseConfig *config.PostgresDatabaseConfig,
+	session *config.AzureSession,
+) (*armpostgresqlflexibleservers.Database, error) {
+	databasesClient, err := session.CreatePostgresDatabasesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres databases client from session: %w", err)
+	}
+
+	pollerResp, err := databasesClient.BeginCreate(
+		ctx,
+		*postgresConfig.ResourceGroup,
+		*postgresConfig.Name,
+		*databaseConfig.Name,
+		armpostgresqlflexibleservers.Database{
+			Properties: &armpostgresqlflexibleservers.DatabaseProperties{
+				Charset:   databaseConfig.Charset,
+				Collation: databaseConfig.Collation,
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Database, nil
+}
+
+func DeletePostgresServer(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+	deleteMode DeleteMode,
+	force bool,
+) error {
+	if deleteMode == DeleteModeServerOnly {
+		if err := deletePostgresFlexibleServer(ctx, postgresConfig, session); err != nil {
+			return fmt.Errorf("could not delete the postgres flexible server: %w", err)
+		}
+
+		if err := resourcegroup.CleanupEmptyResourceGroup(&postgresConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the postgres flexible server: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := resourcegroup.CleanupResourceGroup(&postgresConfig.AzureResourceConfig, session, ctx, force); err != nil {
+		return fmt.Errorf("could not clean up resource group for the postgres flexible server: %w", err)
+	}
+
+	return nil
+}
+
+func deletePostgresFlexibleServer(
+	ctx context.Context,
+	postgresConfig *config.AzurePostgresConfig,
+	session *config.AzureSession,
+) error {
+	serversClient, err := session.CreatePostgresServersClient()
+	if err != nil {
+		return fmt.Errorf("could not create postgres servers client from session: %w", err)
+	}
+
+	log.Printf("deleting postgres flexible server %s...", *postgresConfig.Name)
+	pollerResp, err := serversClient.BeginDelete(ctx, *postgresConfig.ResourceGroup, *postgresConfig.Name, nil)
+	if err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("postgres flexible server %s does not exist", *postgresConfig.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to run Delete for postgres flexible server %s: %w", *postgresConfig.Name, err)
+	}
+
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run Delete for postgres flexible server %s: %w", *postgresConfig.Name, err)
+	}
+
+	log.Printf("deleted postgres flexible server %s", *postgresConfig.Name)
+
+	return nil
+}
@@ -4,100 +4,360 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
 	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/keyvault"
 	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/secret"
+	"github.com/nukleros/azure-builder/pkg/util"
 )
 
+// sqlAdministratorPasswordLength is the length of generated administrator
+// passwords.
+const sqlAdministratorPasswordLength = 32
+
+// SqlServer is the output of a sql stack: the Azure SQL server and the
+// databases and network rules declared in the sql config. ServerShared is
+// set when the databases were added to a server that already existed and is
+// not owned by the stack, in which case the server is not part of the stack.
+// A server in a resource group azure-builder created for this stack is owned
+// by it, so re-running the stack to add databases keeps the server.
+type SqlServer struct {
+	ServerShared        bool                         `json:"serverShared"`
+	Server              *armsql.Server               `json:"server"`
+	Databases           []*armsql.Database           `json:"databases,omitempty"`
+	FirewallRules       []*armsql.FirewallRule       `json:"firewallRules,omitempty"`
+	VirtualNetworkRules []*armsql.VirtualNetworkRule `json:"virtualNetworkRules,omitempty"`
+}
+
+// CreateSqlDb creates the sql server with its databases and network rules.
+// Once the resource group exists the server is returned also when a later
+// step fails, with Server nil when it was not created or updated.
 func CreateSqlDb(
-	sqlConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
-) (*armsql.Server, *armsql.Database, error) {
-	if err := credentialsConfig.ValidateNotNull(); err != nil {
-		return nil, nil, fmt.Errorf("could not validate credentials config: %w", err)
+	ctx context.Context,
+	sqlConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+) (*SqlServer, error) {
+	if err := sqlConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate sql config: %w", err)
 	}
 
-	ctx := context.Background()
+	var customerManagedKey *keyvault.CustomerManagedKey
+	if sqlConfig.CustomerManagedKey != nil {
+		key, err := keyvault.CheckCustomerManagedKey(ctx, sqlConfig.CustomerManagedKey, session)
+		if err != nil {
+			return nil, fmt.Errorf("could not verify customer managed key: %w", err)
+		}
+		customerManagedKey = key
+	}
 
-	resourceGroup, err := resourcegroup.CreateResourceGroup(sqlConfig, credentialsConfig, ctx)
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&sqlConfig.AzureResourceConfig, session, ctx)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not create the resource group: %w", err)
+		return nil, fmt.Errorf("could not create the resource group: %w", err)
 	}
 	log.Println("resources group:", *resourceGroup.ID)
 
-	server, err := createSqlServer(ctx, sqlConfig, credentialsConfig)
+	sqlServer := &SqlServer{}
+
+	server, serverExisted, err := createSqlServer(ctx, sqlConfig, customerManagedKey, session)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not create sql server: %w", err)
+		return sqlServer, fmt.Errorf("could not create sql server: %w", err)
 	}
 	log.Println("server:", *server.ID)
 
-	database, err := createSqlDatabase(ctx, sqlConfig, credentialsConfig)
+	serverShared := serverExisted &&
+		resourcegroup.CheckOwnership(resourceGroup, sqlConfig.GetStackName()) != nil
+	sqlServer.Server = server
+	sqlServer.ServerShared = serverShared
+
+	if customerManagedKey != nil {
+		if err := configureTransparentDataEncryption(ctx, sqlConfig, customerManagedKey, session); err != nil {
+			return sqlServer, fmt.Errorf("could not configure transparent data encryption: %w", err)
+		}
+	}
+
+	// rules that are not in the config are only deleted from a server that
+	// belongs to the stack, unless pruning them is asked for
+	pruneRules := !serverShared || sqlConfig.GetPruneNetworkRules()
+
+	if sqlServerPublicNetworkAccessEnabled(sqlConfig, server) {
+		firewallRules, err := reconcileSqlFirewallRules(ctx, sqlConfig, pruneRules, session)
+		if err != nil {
+			return sqlServer, fmt.Errorf("could not reconcile sql firewall rules: %w", err)
+		}
+		sqlServer.FirewallRules = firewallRules
+	} else {
+		log.Printf("public network access of sql server %s is disabled, skipping firewall rules", sqlConfig.GetServerName())
+	}
+
+	virtualNetworkRules, err := reconcileSqlVirtualNetworkRules(ctx, sqlConfig, pruneRules, session)
 	if err != nil {
-		return nil, nil, fmt.Errorf("could not create sql database: %w", err)
+		return sqlServer, fmt.Errorf("could not reconcile sql virtual network rules: %w", err)
 	}
-	log.Println("database:", *database.ID)
+	sqlServer.VirtualNetworkRules = virtualNetworkRules
 
-	return server, database, nil
+	for _, databaseConfig := range sqlConfig.GetDatabases() {
+		database, err := createSqlDatabase(ctx, sqlConfig, databaseConfig, session)
+		if err != nil {
+			return sqlServer, fmt.Errorf("could not create sql database %s: %w", *databaseConfig.Name, err)
+		}
+		log.Println("database:", *database.ID)
+		sqlServer.Databases = append(sqlServer.Databases, database)
+	}
+
+	return sqlServer, nil
 }
 
+// createSqlServer creates the server, or updates it when it already exists so
+// databases can be added to it. The administrator credentials can only be set
+// when the server is created, an existing server keeps its login and
+// password and only has its network settings and customer-managed key
+// identity updated. The returned flag is set when the server already existed.
 func createSqlServer(
 	ctx context.Context,
-	serverConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
-) (*armsql.Server, error) {
+	serverConfig *config.AzureSqlConfig,
+	customerManagedKey *keyvault.CustomerManagedKey,
+	session *config.AzureSession,
+) (*armsql.Server, bool, error) {
+	serverName := serverConfig.GetServerName()
 
-	serversClient, err := credentialsConfig.CreateAzureSqlServersClient()
+	serversClient, err := session.CreateAzureSqlServersClient()
 	if err != nil {
-		return nil, fmt.Errorf("could not create servers client: %w", err)
+		return nil, false, fmt.Errorf("could not create servers client: %w", err)
+	}
+
+	existingServer, err := serversClient.Get(ctx, *serverConfig.ResourceGroup, serverName, nil)
+	if err == nil {
+		log.Printf("sql server %s already exists, updating it", *existingServer.Name)
+		server, err := updateSqlServer(ctx, serverConfig, customerManagedKey, session)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if serverConfig.EntraAdmin != nil {
+			if err := configureSqlEntraAuthentication(ctx, serverConfig, session); err != nil {
+				return nil, false, fmt.Errorf("could not configure entra authentication: %w", err)
+			}
+		}
+
+		return server, true, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, false, fmt.Errorf("failed to run Get for sql server %s: %w", serverName, err)
+	}
+
+	server := armsql.Server{
+		Location: serverConfig.Region,
+		Properties: &armsql.ServerProperties{
+			PublicNetworkAccess: sqlServerPublicNetworkAccess(serverConfig),
+			MinimalTLSVersion:   to.Ptr(serverConfig.GetMinimalTLSVersion()),
+		},
+	}
+
+	// a server with entra-only authentication has no SQL administrator
+	if !serverConfig.GetEntraOnlyAuthentication() {
+		password, err := sqlAdministratorPassword(ctx, serverConfig, session)
+		if err != nil {
+			return nil, false, err
+		}
+		server.Properties.AdministratorLogin = to.Ptr(serverConfig.GetAdministratorLogin())
+		server.Properties.AdministratorLoginPassword = to.Ptr(password)
+	}
+
+	if serverConfig.EntraAdmin != nil {
+		administrator, err := sqlServerEntraAdmin(serverConfig, session)
+		if err != nil {
+			return nil, false, err
+		}
+		server.Properties.Administrators = administrator
+	}
+
+	server.Identity, server.Properties.PrimaryUserAssignedIdentityID = sqlServerIdentity(serverConfig, customerManagedKey)
+	if customerManagedKey != nil {
+		server.Properties.KeyID = to.Ptr(customerManagedKey.KeyURIWithVersion)
 	}
 
 	pollerResp, err := serversClient.BeginCreateOrUpdate(
 		ctx,
 		*serverConfig.ResourceGroup,
-		*serverConfig.Name,
-		armsql.Server{
-			Location: serverConfig.Region,
-			Properties: &armsql.ServerProperties{
-				AdministratorLogin:         to.Ptr("dummylogin"),
-				AdministratorLoginPassword: to.Ptr("QWE123!@#"),
-			},
-		},
+		serverName,
+		server,
 		nil,
 	)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	resp, err := pollerResp.PollUntilDone(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	return &resp.Server, false, nil
+}
+
+// updateSqlServer applies the managed identities and the customer-managed key
+// to an existing server, and its public network access and minimal TLS
+// version when they are set in the sql config.
+func updateSqlServer(
+	ctx context.Context,
+	serverConfig *config.AzureSqlConfig,
+	customerManagedKey *keyvault.CustomerManagedKey,
+	session *config.AzureSession,
+) (*armsql.Server, error) {
+	serversClient, err := session.CreateAzureSqlServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create servers client: %w", err)
+	}
+
+	serverUpdate := armsql.ServerUpdate{
+		Properties: &armsql.ServerProperties{},
+	}
+	if serverConfig.PublicNetworkAccess != nil {
+		serverUpdate.Properties.PublicNetworkAccess = sqlServerPublicNetworkAccess(serverConfig)
+	}
+	if serverConfig.MinimalTLSVersion != nil {
+		serverUpdate.Properties.MinimalTLSVersion = serverConfig.MinimalTLSVersion
+	}
+
+	serverUpdate.Identity, serverUpdate.Properties.PrimaryUserAssignedIdentityID = sqlServerIdentity(serverConfig, customerManagedKey)
+	if customerManagedKey != nil {
+		serverUpdate.Properties.KeyID = to.Ptr(customerManagedKey.KeyURIWithVersion)
+	}
+
+	pollerResp, err := serversClient.BeginUpdate(
+		ctx,
+		*serverConfig.ResourceGroup,
+		serverConfig.GetServerName(),
+		serverUpdate,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Update for sql server %s: %w", serverConfig.GetServerName(), err)
+	}
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Update for sql server %s: %w", serverConfig.GetServerName(), err)
 	}
 	return &resp.Server, nil
 }
 
+func sqlServerPublicNetworkAccess(serverConfig *config.AzureSqlConfig) *armsql.ServerNetworkAccessFlag {
+	if serverConfig.GetPublicNetworkAccess() {
+		return to.Ptr(armsql.ServerNetworkAccessFlagEnabled)
+	}
+
+	return to.Ptr(armsql.ServerNetworkAccessFlagDisabled)
+}
+
+// sqlServerPublicNetworkAccessEnabled returns whether the public endpoint of
+// the server is enabled, going by the server itself when the sql config
+// leaves it unset.
+func sqlServerPublicNetworkAccessEnabled(serverConfig *config.AzureSqlConfig, server *armsql.Server) bool {
+	if serverConfig.PublicNetworkAccess == nil && server.Properties != nil && server.Properties.PublicNetworkAccess != nil {
+		return *server.Properties.PublicNetworkAccess == armsql.ServerNetworkAccessFlagEnabled
+	}
+
+	return serverConfig.GetPublicNetworkAccess()
+}
+
+// sqlAdministratorPassword returns the configured administrator password or
+// generates one. A generated password is written to the password sink before
+// the server is created so it is not lost if creating the server fails, a
+// configured password is only written when a sink is set explicitly.
+func sqlAdministratorPassword(
+	ctx context.Context,
+	serverConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+) (string, error) {
+	password, configured := serverConfig.GetAdministratorPassword()
+	if configured && serverConfig.AdministratorPasswordSink == nil {
+		return password, nil
+	}
+
+	if !configured {
+		login := serverConfig.GetAdministratorLogin()
+		for password == "" || config.ValidateSqlAdministratorPassword(login, password) != nil {
+			generated, err := util.GeneratePassword(sqlAdministratorPasswordLength)
+			if err != nil {
+				return "", fmt.Errorf("could not generate administrator password: %w", err)
+			}
+			password = generated
+		}
+	}
+
+	if err := secret.Write(
+		ctx,
+		serverConfig.GetAdministratorPasswordSink(),
+		sqlAdministratorPasswordName(serverConfig),
+		fmt.Sprintf("administrator password of sql server %s", serverConfig.GetServerName()),
+		password,
+		session,
+	); err != nil {
+		return "", fmt.Errorf("could not write administrator password: %w", err)
+	}
+
+	return password, nil
+}
+
+// sqlAdministratorPasswordName is the default file name and key vault secret
+// name of the administrator password.
+func sqlAdministratorPasswordName(serverConfig *config.AzureSqlConfig) string {
+	return fmt.Sprintf("%s-sql-admin-password", serverConfig.GetServerName())
+}
+
 func createSqlDatabase(
 	ctx context.Context,
-	dbConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	serverConfig *config.AzureSqlConfig,
+	databaseConfig *config.SqlDatabaseConfig,
+	session *config.AzureSession,
 ) (*armsql.Database, error) {
 
-	databaseClient, err := credentialsConfig.CreateAzureSqlDatabaseClient()
+	databaseClient, err := session.CreateAzureSqlDatabaseClient()
 	if err != nil {
 		return nil, fmt.Errorf("could not create database client: %w", err)
 	}
 
+	database := armsql.Database{
+		Location: serverConfig.Region,
+		SKU: &armsql.SKU{
+			Name: to.Ptr(databaseConfig.GetSKUName()),
+		},
+		Properties: &armsql.DatabaseProperties{
+			ReadScale:     to.Ptr(armsql.DatabaseReadScaleDisabled),
+			Collation:     databaseConfig.Collation,
+			ZoneRedundant: to.Ptr(databaseConfig.GetZoneRedundant()),
+		},
+	}
+
+	// DTU service objectives have a fixed capacity, vCore editions are sized
+	// by their number of vCores
+	if !databaseConfig.IsDTU() {
+		database.SKU.Capacity = to.Ptr(databaseConfig.GetCapacity())
+	}
+
+	if databaseConfig.IsServerless() {
+		database.Properties.MinCapacity = to.Ptr(databaseConfig.GetMinCapacity())
+		database.Properties.AutoPauseDelay = to.Ptr(databaseConfig.GetAutoPauseDelayMinutes())
+	}
+
+	if databaseConfig.MaxSizeGB != nil {
+		database.Properties.MaxSizeBytes = to.Ptr(*databaseConfig.MaxSizeGB * 1024 * 1024 * 1024)
+	}
+
+	if databaseConfig.BackupStorageRedundancy != nil {
+		database.Properties.RequestedBackupStorageRedundancy = to.Ptr(armsql.BackupStorageRedundancy(*databaseConfig.BackupStorageRedundancy))
+	}
+
 	pollerResp, err := databaseClient.BeginCreateOrUpdate(
 		ctx,
-		*dbConfig.ResourceGroup,
-		*dbConfig.Name,
-		*dbConfig.Name,
-		armsql.Database{
-			Location: dbConfig.Region,
-			Properties: &armsql.DatabaseProperties{
-				ReadScale: to.Ptr(armsql.DatabaseReadScaleDisabled),
-			},
-		},
+		*serverConfig.ResourceGroup,
+		serverConfig.GetServerName(),
+		*databaseConfig.Name,
+		database,
 		nil,
 	)
 	if err != nil {
@@ -109,3 +369,261 @@ func createSqlDatabase(
 	}
 	return &resp.Database, nil
 }
+
+// configureTransparentDataEncryption registers the key vault key with the
+// server and makes it the TDE protector. When the key is not pinned to a
+// version the protector follows key rotations.
+func configureTransparentDataEncryption(
+	ctx context.Context,
+	serverConfig *config.AzureSqlConfig,
+	customerManagedKey *keyvault.CustomerManagedKey,
+	session *config.AzureSession,
+) error {
+	serverKeysClient, err := session.CreateAzureSqlServerKeysClient()
+	if err != nil {
+		return fmt.Errorf("could not create server keys client: %w", err)
+	}
+
+	// server keys are named <vault>_<key>_<version>
+	serverKeyName := fmt.Sprintf("%s_%s_%s", customerManagedKey.VaultName, customerManagedKey.KeyName, customerManagedKey.KeyVersion)
+
+	keyPoller, err := serverKeysClient.BeginCreateOrUpdate(
+		ctx,
+		*serverConfig.ResourceGroup,
+		serverConfig.GetServerName(),
+		serverKeyName,
+		armsql.ServerKey{
+			Properties: &armsql.ServerKeyProperties{
+				ServerKeyType: to.Ptr(armsql.ServerKeyTypeAzureKeyVault),
+				URI:           to.Ptr(customerManagedKey.KeyURIWithVersion),
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for server key %s: %w", serverKeyName, err)
+	}
+	if _, err := keyPoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for server key %s: %w", serverKeyName, err)
+	}
+
+	encryptionProtectorsClient, err := session.CreateAzureSqlEncryptionProtectorsClient()
+	if err != nil {
+		return fmt.Errorf("could not create encryption protectors client: %w", err)
+	}
+
+	protectorPoller, err := encryptionProtectorsClient.BeginCreateOrUpdate(
+		ctx,
+		*serverConfig.ResourceGroup,
+		serverConfig.GetServerName(),
+		armsql.EncryptionProtectorNameCurrent,
+		armsql.EncryptionProtector{
+			Properties: &armsql.EncryptionProtectorProperties{
+				ServerKeyType:       to.Ptr(armsql.ServerKeyTypeAzureKeyVault),
+				ServerKeyName:       to.Ptr(serverKeyName),
+				AutoRotationEnabled: to.Ptr(customerManagedKey.AutoRotation),
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for encryption protector: %w", err)
+	}
+	if _, err := protectorPoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for encryption protector: %w", err)
+	}
+
+	log.Printf("set TDE protector of server %s to key %s", serverConfig.GetServerName(), serverKeyName)
+
+	return nil
+}
+
+// DeleteSqlDb deletes the databases declared in the sql config and then the
+// server. A server that holds databases that are not in the sql config is
+// shared with something else, so only the declared databases are deleted and
+// the server is kept unless deleteSharedServer is set. With
+// DeleteModeServerOnly the same goes for a server in a resource group
+// azure-builder did not create for this stack, as the stack did not create
+// the server, and the resource group is only removed when azure-builder
+// created it and it is empty. Deleting a resource group azure-builder did not
+// create for this stack is refused before anything is deleted unless force is
+// set.
+func DeleteSqlDb(
+	ctx context.Context,
+	sqlConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+	deleteMode DeleteMode,
+	deleteSharedServer bool,
+	force bool,
+) error {
+	resourceGroupsClient, err := session.CreateAzureResourceGroupsClient()
+	if err != nil {
+		return fmt.Errorf("could not create resource groups client from session: %w", err)
+	}
+
+	resourceGroupResp, err := resourceGroupsClient.Get(ctx, *sqlConfig.ResourceGroup, nil)
+	if err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("resource group %s does not exist", *sqlConfig.ResourceGroup)
+			return nil
+		}
+		return fmt.Errorf("could not get resource group %s: %w", *sqlConfig.ResourceGroup, err)
+	}
+
+	ownershipErr := resourcegroup.CheckOwnership(&resourceGroupResp.ResourceGroup, sqlConfig.GetStackName())
+	if ownershipErr != nil && deleteMode == DeleteModeResourceGroup && !force {
+		return fmt.Errorf("refusing to delete resource group, use force to override: %w", ownershipErr)
+	}
+
+	otherDatabases, err := listSqlUserDatabases(ctx, sqlConfig, session)
+	if err != nil {
+		return err
+	}
+
+	declaredDatabases := make(map[string]bool)
+	for _, databaseConfig := range sqlConfig.GetDatabases() {
+		declaredDatabases[strings.ToLower(*databaseConfig.Name)] = true
+	}
+	otherDatabases = slices.DeleteFunc(otherDatabases, func(name string) bool {
+		return declaredDatabases[strings.ToLower(name)]
+	})
+
+	keepServer := false
+	switch {
+	case deleteSharedServer:
+	case ownershipErr != nil && deleteMode == DeleteModeServerOnly:
+		keepServer = true
+		log.Printf("keeping sql server %s, it was not created by this stack: %v", sqlConfig.GetServerName(), ownershipErr)
+	case len(otherDatabases) > 0:
+		keepServer = true
+		log.Printf("keeping sql server %s, it still holds databases that are not in the sql config: %s",
+			sqlConfig.GetServerName(), strings.Join(otherDatabases, ", "))
+	}
+
+	for _, databaseConfig := range sqlConfig.GetDatabases() {
+		if err := deleteSqlDatabase(ctx, sqlConfig, *databaseConfig.Name, session); err != nil {
+			return fmt.Errorf("could not delete sql database %s: %w", *databaseConfig.Name, err)
+		}
+	}
+
+	if keepServer {
+		if err := resourcegroup.CleanupEmptyResourceGroup(&sqlConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the sql server: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := deleteSqlServer(ctx, sqlConfig, session); err != nil {
+		return fmt.Errorf("could not delete the sql server: %w", err)
+	}
+
+	if deleteMode == DeleteModeServerOnly {
+		if err := resourcegroup.CleanupEmptyResourceGroup(&sqlConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the sql server: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := resourcegroup.CleanupResourceGroup(&sqlConfig.AzureResourceConfig, session, ctx, force); err != nil {
+		return fmt.Errorf("could not clean up resource group for the sql server: %w", err)
+	}
+
+	return nil
+}
+
+func deleteSqlDatabase(
+	ctx context.Context,
+	sqlConfig *config.AzureSqlConfig,
+	databaseName string,
+	session *config.AzureSession,
+) error {
+	databasesClient, err := session.CreateAzureSqlDatabaseClient()
+	if err != nil {
+		return fmt.Errorf("could not create database client: %w", err)
+	}
+
+	log.Printf("deleting sql database %s...", databaseName)
+	pollerResp, err := databasesClient.BeginDelete(ctx, *sqlConfig.ResourceGroup, sqlConfig.GetServerName(), databaseName, nil)
+	if err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("sql database %s does not exist", databaseName)
+			return nil
+		}
+		return fmt.Errorf("failed to run Delete for sql database %s: %w", databaseName, err)
+	}
+
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run Delete for sql database %s: %w", databaseName, err)
+	}
+
+	log.Printf("deleted sql database %s", databaseName)
+
+	return nil
+}
+
+// listSqlUserDatabases returns the names of the databases on the server,
+// leaving out the master database every server has.
+func listSqlUserDatabases(
+	ctx context.Context,
+	sqlConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+) ([]string, error) {
+	databasesClient, err := session.CreateAzureSqlDatabaseClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create database client: %w", err)
+	}
+
+	var databaseNames []string
+	pager := databasesClient.NewListByServerPager(*sqlConfig.ResourceGroup, sqlConfig.GetServerName(), nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			if util.IsNotFoundError(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to run ListByServer for databases of sql server %s: %w", sqlConfig.GetServerName(), err)
+		}
+
+		for _, database := range page.Value {
+			if database.Name != nil && !strings.EqualFold(*database.Name, "master") {
+				databaseNames = append(databaseNames, *database.Name)
+			}
+		}
+	}
+	sort.Strings(databaseNames)
+
+	return databaseNames, nil
+}
+
+func deleteSqlServer(
+	ctx context.Context,
+	sqlConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+) error {
+	serverName := sqlConfig.GetServerName()
+
+	serversClient, err := session.CreateAzureSqlServersClient()
+	if err != nil {
+		return fmt.Errorf("could not create servers client: %w", err)
+	}
+
+	log.Printf("deleting sql server %s...", serverName)
+	pollerResp, err := serversClient.BeginDelete(ctx, *sqlConfig.ResourceGroup, serverName, nil)
+	if err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("sql server %s does not exist", serverName)
+			return nil
+		}
+		return fmt.Errorf("failed to run Delete for sql server %s: %w", serverName, err)
+	}
+
+	if _, err = pollerResp.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run Delete for sql server %s: %w", serverName, err)
+	}
+
+	log.Printf("deleted sql server %s", serverName)
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+const (
+	// SqlPort is the port Azure SQL servers accept connections on.
+	SqlPort = 1433
+
+	sqlPasswordPlaceholder = "{your_password}"
+)
+
+// SqlConnectionInfo describes how to connect to the databases of a sql
+// stack. Connection strings are in ADO.NET format.
+type SqlConnectionInfo struct {
+	ServerName         string                       `json:"serverName"`
+	FQDN               string                       `json:"fqdn"`
+	Port               int                          `json:"port"`
+	AdministratorLogin string                       `json:"administratorLogin,omitempty"`
+	Databases          []*SqlDatabaseConnectionInfo `json:"databases"`
+}
+
+// SqlDatabaseConnectionInfo is a database of the sql stack and the
+// connection string for it.
+type SqlDatabaseConnectionInfo struct {
+	Name             string `json:"name"`
+	ConnectionString string `json:"connectionString"`
+}
+
+// GetSqlConnectionInfo returns the connection info of the server and of the
+// databases declared in the sql config that exist. The connection strings
+// contain the given administrator password, or a placeholder when it is
+// empty. Servers with Entra-only authentication get connection strings that
+// sign in with Microsoft Entra ID instead.
+func GetSqlConnectionInfo(
+	ctx context.Context,
+	sqlConfig *config.AzureSqlConfig,
+	password string,
+	session *config.AzureSession,
+) (*SqlConnectionInfo, error) {
+	serverName := sqlConfig.GetServerName()
+
+	serversClient, err := session.CreateAzureSqlServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create servers client: %w", err)
+	}
+
+	server, err := serversClient.Get(ctx, *sqlConfig.ResourceGroup, serverName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run Get for sql server %s: %w", serverName, err)
+	}
+
+	if server.Properties == nil || server.Properties.FullyQualifiedDomainName == nil {
+		return nil, fmt.Errorf("sql server %s has no fully qualified domain name", serverName)
+	}
+
+	connectionInfo := &SqlConnectionInfo{
+		ServerName: serverName,
+		FQDN:       *server.Properties.FullyQualifiedDomainName,
+		Port:       SqlPort,
+	}
+
+	entraOnly := sqlConfig.GetEntraOnlyAuthentication()
+	if !entraOnly && server.Properties.AdministratorLogin != nil {
+		connectionInfo.AdministratorLogin = *server.Properties.AdministratorLogin
+	}
+
+	if password == "" {
+		password = sqlPasswordPlaceholder
+	}
+
+	databasesClient, err := session.CreateAzureSqlDatabaseClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create database client: %w", err)
+	}
+
+	for _, databaseConfig := range sqlConfig.GetDatabases() {
+		if _, err := databasesClient.Get(ctx, *sqlConfig.ResourceGroup, serverName, *databaseConfig.Name, nil); err != nil {
+			if util.IsNotFoundError(err) {
+				log.Printf("sql database %s does not exist", *databaseConfig.Name)
+				continue
+			}
+			return nil, fmt.Errorf("failed to run Get for sql database %s: %w", *databaseConfig.Name, err)
+		}
+
+		connectionString := fmt.Sprintf(
+			"Server=tcp:%s,%d;Initial Catalog=%s;Persist Security Info=False;",
+			connectionInfo.FQDN, SqlPort, *databaseConfig.Name,
+		)
+		if entraOnly {
+			connectionString += "Authentication=Active Directory Default;"
+		} else {
+			connectionString += fmt.Sprintf("User ID=%s;Password=%s;", connectionInfo.AdministratorLogin, password)
+		}
+		connectionString += "MultipleActiveResultSets=False;Encrypt=True;TrustServerCertificate=False;Connection Timeout=30;"
+
+		connectionInfo.Databases = append(connectionInfo.Databases, &SqlDatabaseConnectionInfo{
+			Name:             *databaseConfig.Name,
+			ConnectionString: connectionString,
+		})
+	}
+
+	return connectionInfo, nil
+}
+
+// LookupSqlAdministratorPassword returns the administrator password from the
+// sql config, the environment or the file it was written to when it was
+// generated. Passwords written to stdout or Key Vault cannot be read back.
+func LookupSqlAdministratorPassword(sqlConfig *config.AzureSqlConfig) (string, error) {
+	if password, ok := sqlConfig.GetAdministratorPassword(); ok {
+		return password, nil
+	}
+
+	sink := sqlConfig.GetAdministratorPasswordSink()
+	switch sink.GetType() {
+	case config.SecretSinkTypeFile:
+		path := sink.GetPath(sqlAdministratorPasswordName(sqlConfig))
+		passwordBytes, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read administrator password file %s: %w", path, err)
+		}
+		return strings.TrimSpace(string(passwordBytes)), nil
+	case config.SecretSinkTypeKeyVault:
+		return "", fmt.Errorf("administrator password is stored in key vault secret %s and has to be read from the vault",
+			sink.GetSecretName(sqlAdministratorPasswordName(sqlConfig)))
+	}
+
+	return "", fmt.Errorf("administrator password was only written to stdout, set it in the sql config or %s", config.SqlAdministratorPasswordEnv)
+}
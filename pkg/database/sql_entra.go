@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/keyvault"
+)
+
+// sqlServerIdentity returns the managed identities of the server and its
+// primary user-assigned identity. The identity of a customer-managed key is
+// always attached and is the primary identity so the server uses it to reach
+// the key vault for the TDE protector.
+func sqlServerIdentity(
+	serverConfig *config.AzureSqlConfig,
+	customerManagedKey *keyvault.CustomerManagedKey,
+) (*armsql.ResourceIdentity, *string) {
+	userAssignedIdentities := make(map[string]*armsql.UserIdentity)
+	var primaryIdentityID *string
+	systemAssigned := false
+
+	if serverConfig.Identity != nil {
+		systemAssigned = serverConfig.Identity.GetSystemAssigned()
+		for _, identityID := range serverConfig.Identity.UserAssignedIdentityIDs {
+			userAssignedIdentities[identityID] = &armsql.UserIdentity{}
+		}
+		primaryIdentityID = serverConfig.Identity.PrimaryUserAssignedIdentityID
+	}
+
+	if customerManagedKey != nil {
+		userAssignedIdentities[customerManagedKey.IdentityID] = &armsql.UserIdentity{}
+		primaryIdentityID = to.Ptr(customerManagedKey.IdentityID)
+	}
+
+	if primaryIdentityID == nil && len(userAssignedIdentities) == 1 {
+		for identityID := range userAssignedIdentities {
+			primaryIdentityID = to.Ptr(identityID)
+		}
+	}
+
+	var identityType armsql.IdentityType
+	switch {
+	case systemAssigned && len(userAssignedIdentities) > 0:
+		identityType = armsql.IdentityTypeSystemAssignedUserAssigned
+	case systemAssigned:
+		identityType = armsql.IdentityTypeSystemAssigned
+	case len(userAssignedIdentities) > 0:
+		identityType = armsql.IdentityTypeUserAssigned
+	default:
+		return nil, nil
+	}
+
+	identity := &armsql.ResourceIdentity{
+		Type: to.Ptr(identityType),
+	}
+	if len(userAssignedIdentities) > 0 {
+		identity.UserAssignedIdentities = userAssignedIdentities
+	}
+
+	return identity, primaryIdentityID
+}
+
+// sqlServerEntraAdmin returns the Microsoft Entra ID administrator set on a
+// new server.
+func sqlServerEntraAdmin(
+	serverConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+) (*armsql.ServerExternalAdministrator, error) {
+	entraAdmin := serverConfig.EntraAdmin
+	tenantID, err := entraAdmin.GetTenantID(session.CredentialsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &armsql.ServerExternalAdministrator{
+		AdministratorType:         to.Ptr(armsql.AdministratorTypeActiveDirectory),
+		Login:                     entraAdmin.PrincipalName,
+		Sid:                       entraAdmin.ObjectID,
+		TenantID:                  to.Ptr(tenantID),
+		PrincipalType:             to.Ptr(sqlPrincipalType(entraAdmin.GetPrincipalType())),
+		AzureADOnlyAuthentication: to.Ptr(serverConfig.GetEntraOnlyAuthentication()),
+	}, nil
+}
+
+// configureSqlEntraAuthentication sets the Microsoft Entra ID administrator
+// of an existing server and then enables or disables Entra-only
+// authentication, which requires the administrator to be set first.
+func configureSqlEntraAuthentication(
+	ctx context.Context,
+	serverConfig *config.AzureSqlConfig,
+	session *config.AzureSession,
+) error {
+	serverName := serverConfig.GetServerName()
+	entraAdmin := serverConfig.EntraAdmin
+
+	tenantID, err := entraAdmin.GetTenantID(session.CredentialsConfig)
+	if err != nil {
+		return err
+	}
+
+	administratorsClient, err := session.CreateAzureSqlServerAzureADAdministratorsClient()
+	if err != nil {
+		return fmt.Errorf("could not create sql entra administrators client: %w", err)
+	}
+
+	adminPoller, err := administratorsClient.BeginCreateOrUpdate(
+		ctx,
+		*serverConfig.ResourceGroup,
+		serverName,
+		armsql.AdministratorNameActiveDirectory,
+		armsql.ServerAzureADAdministrator{
+			Properties: &armsql.AdministratorProperties{
+				AdministratorType: to.Ptr(armsql.AdministratorTypeActiveDirectory),
+				Login:             entraAdmin.PrincipalName,
+				Sid:               entraAdmin.ObjectID,
+				TenantID:          to.Ptr(tenantID),
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for entra admin %s: %w", *entraAdmin.PrincipalName, err)
+	}
+	if _, err := adminPoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for entra admin %s: %w", *entraAdmin.PrincipalName, err)
+	}
+
+	log.Printf("set entra admin of sql server %s to %s", serverName, *entraAdmin.PrincipalName)
+
+	entraOnlyAuthenticationsClient, err := session.CreateAzureSqlServerAzureADOnlyAuthenticationsClient()
+	if err != nil {
+		return fmt.Errorf("could not create sql entra-only authentications client: %w", err)
+	}
+
+	authPoller, err := entraOnlyAuthenticationsClient.BeginCreateOrUpdate(
+		ctx,
+		*serverConfig.ResourceGroup,
+		serverName,
+		armsql.AuthenticationNameDefault,
+		armsql.ServerAzureADOnlyAuthentication{
+			Properties: &armsql.AzureADOnlyAuthProperties{
+				AzureADOnlyAuthentication: to.Ptr(serverConfig.GetEntraOnlyAuthentication()),
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for entra-only authentication: %w", err)
+	}
+	if _, err := authPoller.PollUntilDone(ctx, nil); err != nil {
+		return fmt.Errorf("failed to run CreateOrUpdate for entra-only authentication: %w", err)
+	}
+
+	log.Printf("set entra-only authentication of sql server %s to %t", serverName, serverConfig.GetEntraOnlyAuthentication())
+
+	return nil
+}
+
+// sqlPrincipalType maps the principal type of the entra admin config to the
+// Azure SQL principal type, which calls service principals applications.
+func sqlPrincipalType(principalType string) armsql.PrincipalType {
+	if principalType == config.EntraPrincipalTypeServicePrincipal {
+		return armsql.PrincipalTypeApplication
+	}
+
+	return armsql.PrincipalType(principalType)
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/sql/armsql"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// reconcileSqlFirewallRules creates or updates the declared firewall rules.
+// With pruneRules set every other firewall rule on the server is deleted, so
+// the server only accepts connections from the address ranges in the sql
+// config.
+func reconcileSqlFirewallRules(
+	ctx context.Context,
+	serverConfig *config.AzureSqlConfig,
+	pruneRules bool,
+	session *config.AzureSession,
+) ([]*armsql.FirewallRule, error) {
+	serverName := serverConfig.GetServerName()
+
+	firewallRulesClient, err := session.CreateAzureSqlFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create firewall rules client: %w", err)
+	}
+
+	declaredRules := make(map[string]bool)
+	var firewallRules []*armsql.FirewallRule
+	for _, ruleConfig := range serverConfig.GetFirewallRules() {
+		declaredRules[*ruleConfig.Name] = true
+
+		resp, err := firewallRulesClient.CreateOrUpdate(
+			ctx,
+			*serverConfig.ResourceGroup,
+			serverName,
+			*ruleConfig.Name,
+			armsql.FirewallRule{
+				Properties: &armsql.ServerFirewallRuleProperties{
+					StartIPAddress: ruleConfig.StartIPAddress,
+					EndIPAddress:   ruleConfig.EndIPAddress,
+				},
+			},
+			nil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run CreateOrUpdate for firewall rule %s: %w", *ruleConfig.Name, err)
+		}
+		log.Println("firewall rule:", *resp.ID)
+		firewallRules = append(firewallRules, &resp.FirewallRule)
+	}
+
+	if !pruneRules {
+		return firewallRules, nil
+	}
+
+	var staleRules []string
+	pager := firewallRulesClient.NewListByServerPager(*serverConfig.ResourceGroup, serverName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run ListByServer for firewall rules of sql server %s: %w", serverName, err)
+		}
+
+		for _, rule := range page.Value {
+			if rule.Name != nil && !declaredRules[*rule.Name] {
+				staleRules = append(staleRules, *rule.Name)
+			}
+		}
+	}
+	sort.Strings(staleRules)
+
+	for _, ruleName := range staleRules {
+		if _, err := firewallRulesClient.Delete(ctx, *serverConfig.ResourceGroup, serverName, ruleName, nil); err != nil {
+			return nil, fmt.Errorf("failed to run Delete for firewall rule %s: %w", ruleName, err)
+		}
+		log.Printf("deleted firewall rule %s of sql server %s that is not in the sql config", ruleName, serverName)
+	}
+
+	return firewallRules, nil
+}
+
+// reconcileSqlVirtualNetworkRules creates or updates the declared virtual
+// network rules. With pruneRules set every other virtual network rule on the
+// server is deleted.
+func reconcileSqlVirtualNetworkRules(
+	ctx context.Context,
+	serverConfig *config.AzureSqlConfig,
+	pruneRules bool,
+	session *config.AzureSession,
+) ([]*armsql.VirtualNetworkRule, error) {
+	serverName := serverConfig.GetServerName()
+
+	virtualNetworkRulesClient, err := session.CreateAzureSqlVirtualNetworkRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create virtual network rules client: %w", err)
+	}
+
+	declaredRules := make(map[string]bool)
+	var virtualNetworkRules []*armsql.VirtualNetworkRule
+	for _, ruleConfig := range serverConfig.VirtualNetworkRules {
+		declaredRules[*ruleConfig.Name] = true
+
+		pollerResp, err := virtualNetworkRulesClient.BeginCreateOrUpdate(
+			ctx,
+			*serverConfig.ResourceGroup,
+			serverName,
+			*ruleConfig.Name,
+			armsql.VirtualNetworkRule{
+				Properties: &armsql.VirtualNetworkRuleProperties{
+					VirtualNetworkSubnetID:           ruleConfig.SubnetID,
+					IgnoreMissingVnetServiceEndpoint: to.Ptr(ruleConfig.GetIgnoreMissingServiceEndpoint()),
+				},
+			},
+			nil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run CreateOrUpdate for virtual network rule %s: %w", *ruleConfig.Name, err)
+		}
+		resp, err := pollerResp.PollUntilDone(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run CreateOrUpdate for virtual network rule %s: %w", *ruleConfig.Name, err)
+		}
+		log.Println("virtual network rule:", *resp.ID)
+		virtualNetworkRules = append(virtualNetworkRules, &resp.VirtualNetworkRule)
+	}
+
+	if !pruneRules {
+		return virtualNetworkRules, nil
+	}
+
+	var staleRules []string
+	pager := virtualNetworkRulesClient.NewListByServerPager(*serverConfig.ResourceGroup, serverName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run ListByServer for virtual network rules of sql server %s: %w", serverName, err)
+		}
+
+		for _, rule := range page.Value {
+			if rule.Name != nil && !declaredRules[*rule.Name] {
+				staleRules = append(staleRules, *rule.Name)
+			}
+		}
+	}
+	sort.Strings(staleRules)
+
+	for _, ruleName := range staleRules {
+		pollerResp, err := virtualNetworkRulesClient.BeginDelete(ctx, *serverConfig.ResourceGroup, serverName, ruleName, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run Delete for virtual network rule %s: %w", ruleName, err)
+		}
+		if _, err := pollerResp.PollUntilDone(ctx, nil); err != nil {
+			return nil, fmt.Errorf("failed to run Delete for virtual network rule %s: %w", ruleName, err)
+		}
+		log.Printf("deleted virtual network rule %s of sql server %s that is not in the sql config", ruleName, serverName)
+	}
+
+	return virtualNetworkRules, nil
+}
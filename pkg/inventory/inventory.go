@@ -0,0 +1,162 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// Stack types recorded in an inventory.
+const (
+	StackTypeAks       = "aks"
+	StackTypeBlob      = "blob"
+	StackTypeKeyVault  = "keyvault"
+	StackTypeMySql     = "mysql"
+	StackTypePostgres  = "postgres"
+	StackTypeSql       = "sql"
+	StackTypeComposite = "composite"
+)
+
+// Kinds of resources recorded in an inventory.
+const (
+	ResourceKindResourceGroup     = "ResourceGroup"
+	ResourceKindManagedCluster    = "ManagedCluster"
+	ResourceKindNodeResourceGroup = "NodeResourceGroup"
+	ResourceKindStorageAccount    = "StorageAccount"
+	ResourceKindSqlServer         = "SqlServer"
+	ResourceKindSqlDatabase       = "SqlDatabase"
+	ResourceKindMySqlServer       = "MySqlFlexibleServer"
+	ResourceKindPostgresServer    = "PostgresFlexibleServer"
+	ResourceKindKeyVault          = "KeyVault"
+)
+
+// Inventory records everything a stack created so that it can later be torn
+// down exactly. Resources are kept in the order they were created.
+type Inventory struct {
+	StackType      string     `json:"stackType"`
+	StackName      string     `json:"stackName"`
+	ConfigHash     string     `json:"configHash"`
+	SubscriptionID string     `json:"subscriptionId"`
+	Resources      []Resource `json:"resources"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// Resource is a single Azure resource created by a stack.
+type Resource struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewInventory(
+	stackType string,
+	resourceConfig *config.AzureResourceConfig,
+	configBytes []byte,
+	session *config.AzureSession,
+) *Inventory {
+	now := time.Now().UTC()
+
+	return &Inventory{
+		StackType:      stackType,
+		StackName:      resourceConfig.GetStackName(),
+		ConfigHash:     HashConfig(configBytes),
+		SubscriptionID: session.SubscriptionID(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// HashConfig returns the SHA-256 hash of the config a stack was created from.
+func HashConfig(configBytes []byte) string {
+	hash := sha256.Sum256(configBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// AddResource records a created resource. Resources that were already recorded
+// are left in place, so a resource is only listed once.
+func (inventory *Inventory) AddResource(kind string, id string) {
+	now := time.Now().UTC()
+	inventory.UpdatedAt = now
+
+	for _, resource := range inventory.Resources {
+		if resource.ID == id {
+			return
+		}
+	}
+
+	inventory.Resources = append(inventory.Resources, Resource{
+		Kind:      kind,
+		ID:        id,
+		CreatedAt: now,
+	})
+}
+
+// Merge adds the resources recorded by an earlier run of the same stack ahead
+// of the resources of this run, so that re-running a stack keeps what it
+// created before in the original order.
+func (inventory *Inventory) Merge(previous *Inventory) error {
+	if previous.StackType != inventory.StackType ||
+		previous.StackName != inventory.StackName ||
+		previous.SubscriptionID != inventory.SubscriptionID {
+		return fmt.Errorf("inventory is for %s stack %s in subscription %s, not %s stack %s in subscription %s",
+			previous.StackType, previous.StackName, previous.SubscriptionID,
+			inventory.StackType, inventory.StackName, inventory.SubscriptionID)
+	}
+
+	resources := append([]Resource{}, previous.Resources...)
+	for _, resource := range inventory.Resources {
+		recorded := false
+		for _, previousResource := range previous.Resources {
+			if previousResource.ID == resource.ID {
+				recorded = true
+				break
+			}
+		}
+		if !recorded {
+			resources = append(resources, resource)
+		}
+	}
+
+	inventory.Resources = resources
+	inventory.CreatedAt = previous.CreatedAt
+
+	return nil
+}
+
+// ResourceGroupID returns the resource ID of a resource group.
+func ResourceGroupID(subscriptionID string, resourceGroupName string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", subscriptionID, resourceGroupName)
+}
+
+func ReadInventory(path string) (*Inventory, error) {
+	inventoryBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read inventory file: %w", err)
+	}
+
+	var inventory Inventory
+	if err = json.Unmarshal(inventoryBytes, &inventory); err != nil {
+		return nil, fmt.Errorf("could not JSON unmarshal inventory: %w", err)
+	}
+
+	return &inventory, nil
+}
+
+func (inventory *Inventory) Write(path string) error {
+	inventoryBytes, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not JSON marshal inventory: %w", err)
+	}
+
+	if err = os.WriteFile(path, inventoryBytes, 0644); err != nil {
+		return fmt.Errorf("could not write inventory file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/nukleros/azure-builder/pkg/config"
+	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+// Teardown deletes the resources recorded in the inventory in the reverse of
+// the order they were created in. Resources that no longer exist are skipped.
+// The resource group is only deleted once it is empty, and only when it is
+// owned by the stack unless force is set.
+func Teardown(
+	ctx context.Context,
+	inventory *Inventory,
+	session *config.AzureSession,
+	force bool,
+) error {
+	if inventory.SubscriptionID != session.SubscriptionID() {
+		return fmt.Errorf("inventory was created in subscription %s but credentials are for subscription %s",
+			inventory.SubscriptionID, session.SubscriptionID())
+	}
+
+	for i := len(inventory.Resources) - 1; i >= 0; i-- {
+		resource := inventory.Resources[i]
+
+		resourceID, err := arm.ParseResourceID(resource.ID)
+		if err != nil {
+			return fmt.Errorf("could not parse resource id %s: %w", resource.ID, err)
+		}
+
+		log.Printf("deleting %s %s...", resource.Kind, resourceID.Name)
+		if err = deleteResource(ctx, resource.Kind, resourceID, inventory, session, force); err != nil {
+			if util.IsNotFoundError(err) {
+				log.Printf("%s %s does not exist", resource.Kind, resourceID.Name)
+				continue
+			}
+			return fmt.Errorf("could not delete %s %s: %w", resource.Kind, resourceID.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func deleteResource(
+	ctx context.Context,
+	kind string,
+	resourceID *arm.ResourceID,
+	inventory *Inventory,
+	session *config.AzureSession,
+	force bool,
+) error {
+	switch kind {
+	case ResourceKindResourceGroup:
+		resourceConfig := config.AzureResourceConfig{
+			Name:          &inventory.StackName,
+			ResourceGroup: &resourceID.Name,
+			StackName:     &inventory.StackName,
+		}
+		return resourcegroup.CleanupEmptyResourceGroup(&resourceConfig, session, ctx, force)
+	case ResourceKindNodeResourceGroup:
+		// azure deletes the node resource group together with its cluster
+		log.Printf("node resource group %s is removed with its cluster", resourceID.Name)
+		return nil
+	case ResourceKindManagedCluster:
+		managedClustersClient, err := session.CreateAzureManagedClustersClient()
+		if err != nil {
+			return fmt.Errorf("could not create managed clusters client from session: %w", err)
+		}
+
+		pollerResp, err := managedClustersClient.BeginDelete(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = pollerResp.PollUntilDone(ctx, nil)
+		return err
+	case ResourceKindStorageAccount:
+		accountsClient, err := session.CreateStorageAccountsClient()
+		if err != nil {
+			return fmt.Errorf("could not create storage accounts client from session: %w", err)
+		}
+
+		_, err = accountsClient.Delete(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+		return err
+	case ResourceKindSqlDatabase:
+		databasesClient, err := session.CreateAzureSqlDatabaseClient()
+		if err != nil {
+			return fmt.Errorf("could not create database client from session: %w", err)
+		}
+
+		pollerResp, err := databasesClient.BeginDelete(ctx, resourceID.ResourceGroupName, resourceID.Parent.Name, resourceID.Name, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = pollerResp.PollUntilDone(ctx, nil)
+		return err
+	case ResourceKindSqlServer:
+		serversClient, err := session.CreateAzureSqlServersClient()
+		if err != nil {
+			return fmt.Errorf("could not create servers client from session: %w", err)
+		}
+
+		pollerResp, err := serversClient.BeginDelete(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = pollerResp.PollUntilDone(ctx, nil)
+		return err
+	case ResourceKindMySqlServer:
+		// databases and firewall rules are deleted together with the server
+		serversClient, err := session.CreateMySqlServersClient()
+		if err != nil {
+			return fmt.Errorf("could not create mysql servers client from session: %w", err)
+		}
+
+		pollerResp, err := serversClient.BeginDelete(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = pollerResp.PollUntilDone(ctx, nil)
+		return err
+	case ResourceKindPostgresServer:
+		// databases, firewall rules and admins are deleted together with the
+		// server
+		serversClient, err := session.CreatePostgresServersClient()
+		if err != nil {
+			return fmt.Errorf("could not create postgres servers client from session: %w", err)
+		}
+
+		pollerResp, err := serversClient.BeginDelete(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = pollerResp.PollUntilDone(ctx, nil)
+		return err
+	case ResourceKindKeyVault:
+		// the vault is kept soft deleted for its retention period
+		vaultsClient, err := session.CreateKeyVaultVaultsClient()
+		if err != nil {
+			return fmt.Errorf("could not create key vaults client from session: %w", err)
+		}
+
+		_, err = vaultsClient.Delete(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+		return err
+	}
+
+	return fmt.Errorf("unsupported resource kind %s in inventory", kind)
+}
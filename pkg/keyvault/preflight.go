@@ -0,0 +1,319 @@
+package keyvault
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// keyEncryptionRoleDefinitionIDs are the built-in roles that grant the key
+// permissions needed for customer-managed key encryption on vaults that use
+// Azure RBAC.
+var keyEncryptionRoleDefinitionIDs = map[string]string{
+	"e147488a-f6f5-4113-8e2d-b22465e65bf6": "Key Vault Crypto Service Encryption User",
+	"12338af0-0e69-4776-bea7-57ae8d297424": "Key Vault Crypto User",
+	"14b46e9e-c2b7-41b4-b07b-48a6ebf60603": "Key Vault Crypto Officer",
+	"00482a5a-887f-4fb3-b363-3b7fe8e74483": "Key Vault Administrator",
+}
+
+// requiredKeyPermissions are the access policy key permissions needed for
+// customer-managed key encryption on vaults that use access policies.
+var requiredKeyPermissions = []armkeyvault.KeyPermissions{
+	armkeyvault.KeyPermissionsGet,
+	armkeyvault.KeyPermissionsWrapKey,
+	armkeyvault.KeyPermissionsUnwrapKey,
+}
+
+// CustomerManagedKey is a key vault key that passed the preflight checks for
+// customer-managed key encryption.
+type CustomerManagedKey struct {
+	VaultID    string
+	VaultName  string
+	VaultURI   string
+	KeyName    string
+	KeyVersion string
+
+	// KeyURIWithVersion is the identifier of the pinned key version, or of the
+	// current version when the key is auto-rotated.
+	KeyURIWithVersion string
+	AutoRotation      bool
+
+	IdentityID          string
+	IdentityPrincipalID string
+}
+
+// CheckCustomerManagedKey verifies that the key exists and is enabled, that
+// the vault has soft delete and purge protection enabled and that the
+// user-assigned identity has been granted the key permissions needed to
+// encrypt with it, either through an access policy or an RBAC role
+// assignment.
+func CheckCustomerManagedKey(
+	ctx context.Context,
+	cmkConfig *config.CustomerManagedKeyConfig,
+	session *config.AzureSession,
+) (*CustomerManagedKey, error) {
+	principalID, err := getIdentityPrincipalID(ctx, *cmkConfig.UserAssignedIdentityID, session)
+	if err != nil {
+		return nil, err
+	}
+
+	vault, err := findVault(ctx, cmkConfig.GetVaultName(), session)
+	if err != nil {
+		return nil, err
+	}
+
+	if vault.Properties.EnableSoftDelete != nil && !*vault.Properties.EnableSoftDelete {
+		return nil, fmt.Errorf("key vault %s must have soft delete enabled", *vault.Name)
+	}
+
+	if vault.Properties.EnablePurgeProtection == nil || !*vault.Properties.EnablePurgeProtection {
+		return nil, fmt.Errorf("key vault %s must have purge protection enabled", *vault.Name)
+	}
+
+	if vault.Properties.EnableRbacAuthorization != nil && *vault.Properties.EnableRbacAuthorization {
+		err = checkRoleAssignments(ctx, vault, cmkConfig.GetKeyName(), principalID, session)
+	} else {
+		err = checkAccessPolicies(vault, principalID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := getKey(ctx, vault, cmkConfig, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Properties.Attributes != nil && key.Properties.Attributes.Enabled != nil && !*key.Properties.Attributes.Enabled {
+		return nil, fmt.Errorf("key %s in key vault %s is disabled", cmkConfig.GetKeyName(), *vault.Name)
+	}
+
+	log.Printf("verified customer managed key %s in key vault %s", cmkConfig.GetKeyName(), *vault.Name)
+
+	return &CustomerManagedKey{
+		VaultID:             *vault.ID,
+		VaultName:           *vault.Name,
+		VaultURI:            cmkConfig.GetVaultURI(),
+		KeyName:             cmkConfig.GetKeyName(),
+		KeyVersion:          path.Base(*key.Properties.KeyURIWithVersion),
+		KeyURIWithVersion:   *key.Properties.KeyURIWithVersion,
+		AutoRotation:        cmkConfig.IsAutoRotated(),
+		IdentityID:          *cmkConfig.UserAssignedIdentityID,
+		IdentityPrincipalID: principalID,
+	}, nil
+}
+
+func getIdentityPrincipalID(
+	ctx context.Context,
+	identityID string,
+	session *config.AzureSession,
+) (string, error) {
+	resourceID, err := arm.ParseResourceID(identityID)
+	if err != nil {
+		return "", fmt.Errorf("could not parse user-assigned identity id %s: %w", identityID, err)
+	}
+
+	if !strings.EqualFold(resourceID.SubscriptionID, session.SubscriptionID()) {
+		return "", fmt.Errorf("user-assigned identity %s must be in subscription %s", identityID, session.SubscriptionID())
+	}
+
+	identitiesClient, err := session.CreateUserAssignedIdentitiesClient()
+	if err != nil {
+		return "", fmt.Errorf("could not create user-assigned identities client from session: %w", err)
+	}
+
+	identity, err := identitiesClient.Get(ctx, resourceID.ResourceGroupName, resourceID.Name, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not get user-assigned identity %s: %w", resourceID.Name, err)
+	}
+
+	if identity.Properties == nil || identity.Properties.PrincipalID == nil {
+		return "", fmt.Errorf("user-assigned identity %s has no principal id", resourceID.Name)
+	}
+
+	return *identity.Properties.PrincipalID, nil
+}
+
+// findVault looks the vault up by name in the session subscription, since the
+// key URI does not include the resource group of the vault.
+func findVault(
+	ctx context.Context,
+	vaultName string,
+	session *config.AzureSession,
+) (*armkeyvault.Vault, error) {
+	resourcesClient, err := session.CreateAzureResourcesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create resources client from session: %w", err)
+	}
+
+	pager := resourcesClient.NewListPager(&armresources.ClientListOptions{
+		Filter: to.Ptr(fmt.Sprintf("resourceType eq 'Microsoft.KeyVault/vaults' and name eq '%s'", vaultName)),
+	})
+
+	var vaultID *arm.ResourceID
+	for pager.More() && vaultID == nil {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run List for key vault %s: %w", vaultName, err)
+		}
+
+		for _, resource := range page.Value {
+			if resource.ID != nil && resource.Name != nil && strings.EqualFold(*resource.Name, vaultName) {
+				if vaultID, err = arm.ParseResourceID(*resource.ID); err != nil {
+					return nil, fmt.Errorf("could not parse key vault id %s: %w", *resource.ID, err)
+				}
+				break
+			}
+		}
+	}
+
+	if vaultID == nil {
+		return nil, fmt.Errorf("could not find key vault %s in subscription %s", vaultName, session.SubscriptionID())
+	}
+
+	vaultsClient, err := session.CreateKeyVaultVaultsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create key vaults client from session: %w", err)
+	}
+
+	vault, err := vaultsClient.Get(ctx, vaultID.ResourceGroupName, vaultID.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get key vault %s: %w", vaultName, err)
+	}
+
+	return &vault.Vault, nil
+}
+
+func getKey(
+	ctx context.Context,
+	vault *armkeyvault.Vault,
+	cmkConfig *config.CustomerManagedKeyConfig,
+	session *config.AzureSession,
+) (*armkeyvault.Key, error) {
+	vaultID, err := arm.ParseResourceID(*vault.ID)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key vault id %s: %w", *vault.ID, err)
+	}
+
+	keysClient, err := session.CreateKeyVaultKeysClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create key vault keys client from session: %w", err)
+	}
+
+	if cmkConfig.IsAutoRotated() {
+		key, err := keysClient.Get(ctx, vaultID.ResourceGroupName, vaultID.Name, cmkConfig.GetKeyName(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get key %s in key vault %s: %w", cmkConfig.GetKeyName(), vaultID.Name, err)
+		}
+
+		return &key.Key, nil
+	}
+
+	key, err := keysClient.GetVersion(ctx, vaultID.ResourceGroupName, vaultID.Name, cmkConfig.GetKeyName(), cmkConfig.GetKeyVersion(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get version %s of key %s in key vault %s: %w",
+			cmkConfig.GetKeyVersion(), cmkConfig.GetKeyName(), vaultID.Name, err)
+	}
+
+	return &key.Key, nil
+}
+
+// checkAccessPolicies verifies the principal has the required key permissions
+// in the access policies of the vault.
+func checkAccessPolicies(vault *armkeyvault.Vault, principalID string) error {
+	granted := make(map[armkeyvault.KeyPermissions]bool)
+	for _, policy := range vault.Properties.AccessPolicies {
+		if policy.ObjectID == nil || !strings.EqualFold(*policy.ObjectID, principalID) || policy.Permissions == nil {
+			continue
+		}
+
+		for _, permission := range policy.Permissions.Keys {
+			granted[armkeyvault.KeyPermissions(strings.ToLower(string(*permission)))] = true
+		}
+	}
+
+	if granted[armkeyvault.KeyPermissionsAll] {
+		return nil
+	}
+
+	var missing []string
+	for _, permission := range requiredKeyPermissions {
+		if !granted[armkeyvault.KeyPermissions(strings.ToLower(string(permission)))] {
+			missing = append(missing, string(permission))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("identity %s is missing key permissions %s in the access policies of key vault %s",
+			principalID, strings.Join(missing, ", "), *vault.Name)
+	}
+
+	return nil
+}
+
+// checkRoleAssignments verifies the principal has been assigned a role that
+// allows key wrapping on the vault, the key or a scope above them.
+func checkRoleAssignments(
+	ctx context.Context,
+	vault *armkeyvault.Vault,
+	keyName string,
+	principalID string,
+	session *config.AzureSession,
+) error {
+	roleAssignmentsClient, err := session.CreateRoleAssignmentsClient()
+	if err != nil {
+		return fmt.Errorf("could not create role assignments client from session: %w", err)
+	}
+
+	pager := roleAssignmentsClient.NewListForScopePager(*vault.ID, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+		Filter: to.Ptr(fmt.Sprintf("principalId eq '%s'", principalID)),
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to run ListForScope for key vault %s: %w", *vault.Name, err)
+		}
+
+		for _, assignment := range page.Value {
+			if assignment.Properties == nil || assignment.Properties.RoleDefinitionID == nil || assignment.Properties.Scope == nil {
+				continue
+			}
+
+			roleName, ok := keyEncryptionRoleDefinitionIDs[strings.ToLower(path.Base(*assignment.Properties.RoleDefinitionID))]
+			if ok && scopeCoversKey(*assignment.Properties.Scope, *vault.ID, keyName) {
+				log.Printf("identity %s has role %s on %s", principalID, roleName, *assignment.Properties.Scope)
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("identity %s has no role assignment granting key encryption on key vault %s", principalID, *vault.Name)
+}
+
+// scopeCoversKey returns true when a role assigned at scope applies to the key
+// in the vault. Role assignments listed for a scope include assignments below
+// it, so assignments on other keys have to be filtered out.
+func scopeCoversKey(scope string, vaultID string, keyName string) bool {
+	scope = strings.ToLower(strings.TrimSuffix(scope, "/"))
+	vaultID = strings.ToLower(vaultID)
+
+	switch {
+	case scope == vaultID, scope == vaultID+"/keys/"+strings.ToLower(keyName):
+		return true
+	case strings.HasPrefix(scope, "/subscriptions/"):
+		return strings.HasPrefix(vaultID, scope+"/")
+	default:
+		// the root and management group scopes are above every subscription
+		return true
+	}
+}
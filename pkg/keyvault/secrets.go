@@ -0,0 +1,61 @@
+package keyvault
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// SetSecret stores the value as a new version of the secret in the named
+// vault and returns the URI of the secret. The secret is written through Azure
+// Resource Manager so no data plane access to the vault is needed.
+func SetSecret(
+	ctx context.Context,
+	vaultName string,
+	secretName string,
+	value string,
+	contentType string,
+	session *config.AzureSession,
+) (string, error) {
+	vault, err := findVault(ctx, vaultName, session)
+	if err != nil {
+		return "", err
+	}
+
+	vaultID, err := arm.ParseResourceID(*vault.ID)
+	if err != nil {
+		return "", fmt.Errorf("could not parse key vault id %s: %w", *vault.ID, err)
+	}
+
+	secretsClient, err := session.CreateKeyVaultSecretsClient()
+	if err != nil {
+		return "", fmt.Errorf("could not create key vault secrets client from session: %w", err)
+	}
+
+	resp, err := secretsClient.CreateOrUpdate(
+		ctx,
+		vaultID.ResourceGroupName,
+		vaultID.Name,
+		secretName,
+		armkeyvault.SecretCreateOrUpdateParameters{
+			Properties: &armkeyvault.SecretProperties{
+				Value:       to.Ptr(value),
+				ContentType: to.Ptr(contentType),
+			},
+		},
+		nil,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to run CreateOrUpdate for secret %s in key vault %s: %w", secretName, vaultName, err)
+	}
+
+	if resp.Properties == nil || resp.Properties.SecretURI == nil {
+		return "", nil
+	}
+
+	return *resp.Properties.SecretURI, nil
+}
@@ -0,0 +1,212 @@
+package keyvault
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/nukleros/azure-builder/pkg/config"
+	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+// KeyVault is the output of creating a key vault stack. It is returned once
+// the resource group exists, also when creating the vault failed, and Vault is
+// nil when the vault was not created. VaultShared is set when the vault
+// already existed and is not in a resource group azure-builder created for
+// this stack, in which case the vault is not part of the stack.
+type KeyVault struct {
+	Vault       *armkeyvault.Vault
+	VaultShared bool
+}
+
+func CreateKeyVault(
+	ctx context.Context,
+	keyVaultConfig *config.AzureKeyVaultConfig,
+	session *config.AzureSession,
+) (*KeyVault, error) {
+	if err := keyVaultConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate key vault config: %w", err)
+	}
+
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&keyVaultConfig.AzureResourceConfig, session, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the resource group: %w", err)
+	}
+
+	log.Println("created resource group id:", *resourceGroup.ID)
+
+	keyVault := &KeyVault{}
+
+	vault, vaultExisted, err := createVault(ctx, keyVaultConfig, session)
+	if err != nil {
+		return keyVault, fmt.Errorf("could not create the key vault: %w", err)
+	}
+	keyVault.Vault = vault
+	keyVault.VaultShared = vaultExisted &&
+		resourcegroup.CheckOwnership(resourceGroup, keyVaultConfig.GetStackName()) != nil
+
+	log.Println("created key vault:", *vault.ID)
+
+	return keyVault, nil
+}
+
+func GetKeyVault(
+	ctx context.Context,
+	keyVaultConfig *config.AzureKeyVaultConfig,
+	session *config.AzureSession,
+) (*armkeyvault.Vault, error) {
+	vaultsClient, err := session.CreateKeyVaultVaultsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create key vaults client from session: %w", err)
+	}
+
+	resp, err := vaultsClient.Get(ctx, *keyVaultConfig.ResourceGroup, *keyVaultConfig.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not get key vault %s: %w", *keyVaultConfig.Name, err)
+	}
+
+	return &resp.Vault, nil
+}
+
+// createVault creates the vault unless it already exists. The returned flag
+// is set when the vault already existed.
+func createVault(
+	ctx context.Context,
+	keyVaultConfig *config.AzureKeyVaultConfig,
+	session *config.AzureSession,
+) (*armkeyvault.Vault, bool, error) {
+	vaultsClient, err := session.CreateKeyVaultVaultsClient()
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create key vaults client from session: %w", err)
+	}
+
+	// the access policies of an existing vault would be reset by a new
+	// CreateOrUpdate, so the vault is left untouched
+	existingVault, err := vaultsClient.Get(ctx, *keyVaultConfig.ResourceGroup, *keyVaultConfig.Name, nil)
+	if err == nil {
+		log.Printf("key vault %s already exists", *keyVaultConfig.Name)
+		return &existingVault.Vault, true, nil
+	}
+	if !util.IsNotFoundError(err) {
+		return nil, false, fmt.Errorf("could not check for existing key vault %s: %w", *keyVaultConfig.Name, err)
+	}
+
+	tenantID, err := keyVaultConfig.GetTenantID(session.CredentialsConfig)
+	if err != nil {
+		return nil, false, err
+	}
+
+	publicNetworkAccess := "Disabled"
+	if keyVaultConfig.GetPublicNetworkAccess() {
+		publicNetworkAccess = "Enabled"
+	}
+
+	properties := &armkeyvault.VaultProperties{
+		TenantID: to.Ptr(tenantID),
+		SKU: &armkeyvault.SKU{
+			Family: to.Ptr(armkeyvault.SKUFamilyA),
+			Name:   to.Ptr(armkeyvault.SKUName(keyVaultConfig.GetSKUName())),
+		},
+		EnableRbacAuthorization:   to.Ptr(keyVaultConfig.GetEnableRBACAuthorization()),
+		EnableSoftDelete:          to.Ptr(true),
+		SoftDeleteRetentionInDays: to.Ptr(keyVaultConfig.GetSoftDeleteRetentionInDays()),
+		PublicNetworkAccess:       to.Ptr(publicNetworkAccess),
+		AccessPolicies:            []*armkeyvault.AccessPolicyEntry{},
+	}
+
+	// purge protection cannot be turned off once it is on, so it is left
+	// unset rather than set to false
+	if keyVaultConfig.GetEnablePurgeProtection() {
+		properties.EnablePurgeProtection = to.Ptr(true)
+	}
+
+	pollerResp, err := vaultsClient.BeginCreateOrUpdate(
+		ctx,
+		*keyVaultConfig.ResourceGroup,
+		*keyVaultConfig.Name,
+		armkeyvault.VaultCreateOrUpdateParameters{
+			Location:   keyVaultConfig.Region,
+			Properties: properties,
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to run CreateOrUpdate for key vault %s: %w", *keyVaultConfig.Name, err)
+	}
+
+	resp, err := pollerResp.PollUntilDone(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to run CreateOrUpdate for key vault %s: %w", *keyVaultConfig.Name, err)
+	}
+
+	return &resp.Vault, false, nil
+}
+
+// DeleteMode controls how much of a key vault stack is removed on delete.
+type DeleteMode int
+
+const (
+	// DeleteModeResourceGroup deletes the entire resource group the key vault
+	// was provisioned in.
+	DeleteModeResourceGroup DeleteMode = iota
+
+	// DeleteModeVaultOnly deletes the key vault and only deletes its resource
+	// group when azure-builder created it and nothing else is left in it.
+	DeleteModeVaultOnly
+)
+
+// DeleteKeyVault deletes the key vault. Deleted vaults are kept soft deleted
+// for their retention period, during which the name cannot be reused unless
+// the vault is purged.
+func DeleteKeyVault(
+	ctx context.Context,
+	keyVaultConfig *config.AzureKeyVaultConfig,
+	session *config.AzureSession,
+	deleteMode DeleteMode,
+	force bool,
+) error {
+	if deleteMode == DeleteModeVaultOnly {
+		if err := deleteVault(ctx, keyVaultConfig, session); err != nil {
+			return fmt.Errorf("could not delete the key vault: %w", err)
+		}
+
+		if err := resourcegroup.CleanupEmptyResourceGroup(&keyVaultConfig.AzureResourceConfig, session, ctx, force); err != nil {
+			return fmt.Errorf("could not clean up resource group for the key vault: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := resourcegroup.CleanupResourceGroup(&keyVaultConfig.AzureResourceConfig, session, ctx, force); err != nil {
+		return fmt.Errorf("could not clean up resource group for the key vault: %w", err)
+	}
+
+	return nil
+}
+
+func deleteVault(
+	ctx context.Context,
+	keyVaultConfig *config.AzureKeyVaultConfig,
+	session *config.AzureSession,
+) error {
+	vaultsClient, err := session.CreateKeyVaultVaultsClient()
+	if err != nil {
+		return fmt.Errorf("could not create key vaults client from session: %w", err)
+	}
+
+	log.Printf("deleting key vault %s...", *keyVaultConfig.Name)
+	if _, err = vaultsClient.Delete(ctx, *keyVaultConfig.ResourceGroup, *keyVaultConfig.Name, nil); err != nil {
+		if util.IsNotFoundError(err) {
+			log.Printf("key vault %s does not exist", *keyVaultConfig.Name)
+			return nil
+		}
+		return fmt.Errorf("failed to run Delete for key vault %s: %w", *keyVaultConfig.Name, err)
+	}
+
+	log.Printf("deleted key vault %s, it is kept soft deleted for %d days", *keyVaultConfig.Name, keyVaultConfig.GetSoftDeleteRetentionInDays())
+
+	return nil
+}
@@ -4,19 +4,49 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armresources"
+	"github.com/google/uuid"
 	"github.com/nukleros/azure-builder/pkg/config"
 )
 
+// Tags stamped on resource groups created by azure-builder so they can be told
+// apart from groups that already existed or that belong to another stack.
+const (
+	ManagedByTagKey   = "managed-by"
+	ManagedByTagValue = "azure-builder"
+	StackNameTagKey   = "azure-builder-stack"
+	StackIDTagKey     = "azure-builder-stack-id"
+	CreatedAtTagKey   = "azure-builder-created-at"
+)
+
+// CreateResourceGroup creates the resource group for a resource config. A group
+// that already exists is returned as is, without adopting it, so its tags are
+// not overwritten.
 func CreateResourceGroup(
 	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	session *config.AzureSession,
 	ctx context.Context,
 ) (*armresources.ResourceGroup, error) {
-	resourceGroupClient, err := credentialsConfig.CreateAzureResourceGroupsClient()
+	resourceGroupClient, err := session.CreateAzureResourceGroupsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create resource groups client from session: %w", err)
+	}
+
+	existenceResp, err := resourceGroupClient.CheckExistence(ctx, *aksConfig.ResourceGroup, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not create resource groups client from credentials config: %w", err)
+		return nil, fmt.Errorf("could not check existence of resource group %s: %w", *aksConfig.ResourceGroup, err)
+	}
+
+	if existenceResp.Success {
+		log.Printf("resource group %s already exists", *aksConfig.ResourceGroup)
+		resourceGroupResp, err := resourceGroupClient.Get(ctx, *aksConfig.ResourceGroup, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not get resource group %s: %w", *aksConfig.ResourceGroup, err)
+		}
+		return &resourceGroupResp.ResourceGroup, nil
 	}
 
 	resourceGroupResp, err := resourceGroupClient.CreateOrUpdate(
@@ -24,6 +54,7 @@ func CreateResourceGroup(
 		*aksConfig.ResourceGroup,
 		armresources.ResourceGroup{
 			Location: aksConfig.Region,
+			Tags:     OwnershipTags(aksConfig.GetStackName()),
 		},
 		nil)
 	if err != nil {
@@ -33,14 +64,70 @@ func CreateResourceGroup(
 	return &resourceGroupResp.ResourceGroup, nil
 }
 
+// OwnershipTags returns the tags that mark a resource group as created by
+// azure-builder for the named stack.
+func OwnershipTags(stackName string) map[string]*string {
+	return map[string]*string{
+		ManagedByTagKey: to.Ptr(ManagedByTagValue),
+		StackNameTagKey: to.Ptr(stackName),
+		StackIDTagKey:   to.Ptr(uuid.NewString()),
+		CreatedAtTagKey: to.Ptr(time.Now().UTC().Format(time.RFC3339)),
+	}
+}
+
+// IsManagedResourceGroup returns true when the resource group was created by
+// azure-builder.
+func IsManagedResourceGroup(resourceGroup *armresources.ResourceGroup) bool {
+	return tagValue(resourceGroup, ManagedByTagKey) == ManagedByTagValue
+}
+
+// CheckOwnership returns an error unless the resource group was created by
+// azure-builder for the named stack.
+func CheckOwnership(resourceGroup *armresources.ResourceGroup, stackName string) error {
+	if !IsManagedResourceGroup(resourceGroup) {
+		return fmt.Errorf("resource group %s was not created by azure-builder", *resourceGroup.Name)
+	}
+
+	if owner := tagValue(resourceGroup, StackNameTagKey); owner != stackName {
+		return fmt.Errorf("resource group %s is owned by stack %q, not %q", *resourceGroup.Name, owner, stackName)
+	}
+
+	return nil
+}
+
+func tagValue(resourceGroup *armresources.ResourceGroup, key string) string {
+	value, ok := resourceGroup.Tags[key]
+	if !ok || value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// CleanupResourceGroup deletes the resource group along with everything in it.
+// Groups that azure-builder did not create for this stack are refused unless
+// force is set.
 func CleanupResourceGroup(
 	aksConfig *config.AzureResourceConfig,
-	credentialsConfig *config.AzureCredentialsConfig,
+	session *config.AzureSession,
 	ctx context.Context,
+	force bool,
 ) error {
-	resourceGroupClient, err := credentialsConfig.CreateAzureResourceGroupsClient()
+	resourceGroupClient, err := session.CreateAzureResourceGroupsClient()
 	if err != nil {
-		return fmt.Errorf("could not create resource groups client from credentials config: %w", err)
+		return fmt.Errorf("could not create resource groups client from session: %w", err)
+	}
+
+	resourceGroupResp, err := resourceGroupClient.Get(ctx, *aksConfig.ResourceGroup, nil)
+	if err != nil {
+		return fmt.Errorf("could not get resource group %s: %w", *aksConfig.ResourceGroup, err)
+	}
+
+	if err := CheckOwnership(&resourceGroupResp.ResourceGroup, aksConfig.GetStackName()); err != nil {
+		if !force {
+			return fmt.Errorf("refusing to delete resource group, use force to override: %w", err)
+		}
+		log.Printf("forcing deletion of resource group: %v", err)
 	}
 
 	log.Println("deleting associated resource groups...")
@@ -58,3 +145,50 @@ func CleanupResourceGroup(
 
 	return nil
 }
+
+// CleanupEmptyResourceGroup deletes the resource group only when no resources
+// are left in it and, unless force is set, it was created by azure-builder for
+// this stack. Groups that are shared with other resources are kept.
+func CleanupEmptyResourceGroup(
+	aksConfig *config.AzureResourceConfig,
+	session *config.AzureSession,
+	ctx context.Context,
+	force bool,
+) error {
+	resourceGroupClient, err := session.CreateAzureResourceGroupsClient()
+	if err != nil {
+		return fmt.Errorf("could not create resource groups client from session: %w", err)
+	}
+
+	resourceGroupResp, err := resourceGroupClient.Get(ctx, *aksConfig.ResourceGroup, nil)
+	if err != nil {
+		return fmt.Errorf("could not get resource group %s: %w", *aksConfig.ResourceGroup, err)
+	}
+
+	if err := CheckOwnership(&resourceGroupResp.ResourceGroup, aksConfig.GetStackName()); err != nil && !force {
+		log.Printf("keeping resource group: %v", err)
+		return nil
+	}
+
+	resourcesClient, err := session.CreateAzureResourcesClient()
+	if err != nil {
+		return fmt.Errorf("could not create resources client from session: %w", err)
+	}
+
+	pager := resourcesClient.NewListByResourceGroupPager(*aksConfig.ResourceGroup, &armresources.ClientListByResourceGroupOptions{
+		Top: to.Ptr[int32](1),
+	})
+	if pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list resources in resource group %s: %w", *aksConfig.ResourceGroup, err)
+		}
+
+		if len(page.Value) > 0 {
+			log.Printf("keeping resource group %s as it still contains resources", *aksConfig.ResourceGroup)
+			return nil
+		}
+	}
+
+	return CleanupResourceGroup(aksConfig, session, ctx, force)
+}
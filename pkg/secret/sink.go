@@ -0,0 +1,69 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/keyvault"
+)
+
+// Write stores the secret value in the configured sink. The name is used as
+// the file name or key vault secret name when the sink does not set one and
+// the description is only used in log messages, the value itself is never
+// logged.
+func Write(
+	ctx context.Context,
+	sink *config.SecretSinkConfig,
+	name string,
+	description string,
+	value string,
+	session *config.AzureSession,
+) error {
+	switch sink.GetType() {
+	case config.SecretSinkTypeFile:
+		path := sink.GetPath(name)
+		if err := writeFile(path, value); err != nil {
+			return err
+		}
+		log.Printf("wrote %s to %s", description, path)
+
+	case config.SecretSinkTypeStdout:
+		fmt.Fprintf(os.Stdout, "%s: %s\n", description, value)
+
+	case config.SecretSinkTypeKeyVault:
+		secretName := sink.GetSecretName(name)
+		secretURI, err := keyvault.SetSecret(ctx, sink.GetVaultName(), secretName, value, "password", session)
+		if err != nil {
+			return fmt.Errorf("could not store %s in key vault: %w", description, err)
+		}
+		log.Printf("stored %s in key vault secret %s", description, secretURI)
+
+	default:
+		return fmt.Errorf("unsupported secret sink Type %s", sink.GetType())
+	}
+
+	return nil
+}
+
+// writeFile writes the value to a file that only the current user can read,
+// tightening the mode of an existing file before it is overwritten.
+func writeFile(path string, value string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open secret file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("could not set mode of secret file %s: %w", path, err)
+	}
+
+	if _, err := file.WriteString(value + "\n"); err != nil {
+		return fmt.Errorf("could not write secret file %s: %w", path, err)
+	}
+
+	return file.Close()
+}
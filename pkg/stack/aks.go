@@ -0,0 +1,149 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/containerservice/armcontainerservice/v2"
+	"github.com/nukleros/azure-builder/pkg/aks"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypeAks,
+		Description: "Azure Kubernetes Service",
+		New:         NewAksStack,
+		Outputs:     []string{"clusterId", "clusterName", "resourceGroup", "nodeResourceGroup", "fqdn"},
+	})
+}
+
+// AksStack is an AKS cluster with its node pools.
+type AksStack struct {
+	base
+	config *config.AzureAksConfig
+}
+
+func NewAksStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var aksConfig config.AzureAksConfig
+	if err := unmarshalConfig(inventory.StackTypeAks, configBytes, &aksConfig, &aksConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	return &AksStack{
+		base:   base{stackType: inventory.StackTypeAks, configBytes: configBytes, session: session},
+		config: &aksConfig,
+	}, nil
+}
+
+func (stack *AksStack) Validate() error {
+	return stack.config.Validate()
+}
+
+func (stack *AksStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	resourceGroup, err := stack.planResourceGroup(ctx, &stack.config.AzureResourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	managedClustersClient, err := stack.session.CreateAzureManagedClustersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create managed clusters client from session: %w", err)
+	}
+
+	cluster, err := planResource(inventory.ResourceKindManagedCluster, *stack.config.Name, func() error {
+		_, err := managedClustersClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agentPoolsClient, err := stack.session.CreateAzureAgentPoolsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create agent pools client from session: %w", err)
+	}
+
+	plan := []*PlannedResource{resourceGroup, cluster}
+	for _, pool := range stack.config.GetNodePools() {
+		nodePool, err := planResource("NodePool", *pool.Name, func() error {
+			_, err := agentPoolsClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *pool.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, nodePool)
+	}
+
+	return plan, nil
+}
+
+func (stack *AksStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	aksCluster, err := aks.CreateAksCluster(ctx, stack.config, stack.session)
+	if aksCluster == nil {
+		return nil, fmt.Errorf("could not create aks cluster: %w", err)
+	}
+
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+	managedCluster := aksCluster.Cluster
+	if managedCluster != nil {
+		stackInventory.AddResource(inventory.ResourceKindManagedCluster, *managedCluster.ID)
+		if managedCluster.Properties != nil && managedCluster.Properties.NodeResourceGroup != nil {
+			stackInventory.AddResource(
+				inventory.ResourceKindNodeResourceGroup,
+				inventory.ResourceGroupID(stack.session.SubscriptionID(), *managedCluster.Properties.NodeResourceGroup),
+			)
+		}
+	}
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create aks cluster: %w", err)
+	}
+
+	stack.setOutputs(managedCluster)
+
+	return stackInventory, nil
+}
+
+func (stack *AksStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	managedCluster, err := aks.GetAksCluster(ctx, stack.config, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not get aks cluster: %w", err)
+	}
+
+	stack.setOutputs(managedCluster)
+
+	return managedCluster, nil
+}
+
+func (stack *AksStack) Delete(ctx context.Context, options DeleteOptions) error {
+	deleteMode := aks.DeleteModeResourceGroup
+	if options.ResourceOnly {
+		deleteMode = aks.DeleteModeClusterOnly
+	}
+
+	if err := aks.DeleteAksCluster(ctx, stack.config, stack.session, deleteMode, options.Force); err != nil {
+		return fmt.Errorf("could not delete aks cluster: %w", err)
+	}
+
+	return nil
+}
+
+func (stack *AksStack) setOutputs(managedCluster *armcontainerservice.ManagedCluster) {
+	stack.outputs = map[string]string{
+		"clusterId":     *managedCluster.ID,
+		"clusterName":   *stack.config.Name,
+		"resourceGroup": *stack.config.ResourceGroup,
+	}
+
+	if managedCluster.Properties == nil {
+		return
+	}
+	if managedCluster.Properties.NodeResourceGroup != nil {
+		stack.outputs["nodeResourceGroup"] = *managedCluster.Properties.NodeResourceGroup
+	}
+	if managedCluster.Properties.Fqdn != nil {
+		stack.outputs["fqdn"] = *managedCluster.Properties.Fqdn
+	}
+}
@@ -0,0 +1,170 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/nukleros/azure-builder/pkg/blob"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypeBlob,
+		Description: "Azure Blob Storage account",
+		New:         NewBlobStack,
+		Outputs:     []string{"storageAccountId", "storageAccountName", "resourceGroup", "blobEndpoint"},
+	})
+}
+
+// BlobStack is a storage account with its containers, queues and file
+// shares.
+type BlobStack struct {
+	base
+	config *config.AzureBlobConfig
+}
+
+func NewBlobStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var blobConfig config.AzureBlobConfig
+	if err := unmarshalConfig(inventory.StackTypeBlob, configBytes, &blobConfig, &blobConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	return &BlobStack{
+		base:   base{stackType: inventory.StackTypeBlob, configBytes: configBytes, session: session},
+		config: &blobConfig,
+	}, nil
+}
+
+func (stack *BlobStack) Validate() error {
+	return stack.config.Validate()
+}
+
+func (stack *BlobStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	resourceGroup, err := stack.planResourceGroup(ctx, &stack.config.AzureResourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	accountsClient, err := stack.session.CreateStorageAccountsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage accounts client from session: %w", err)
+	}
+
+	account, err := planResource(inventory.ResourceKindStorageAccount, *stack.config.Name, func() error {
+		_, err := accountsClient.GetProperties(ctx, *stack.config.ResourceGroup, *stack.config.Name, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := []*PlannedResource{resourceGroup, account}
+
+	blobContainersClient, err := stack.session.CreateBlobContainersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create blob containers client from session: %w", err)
+	}
+
+	for _, containerConfig := range stack.config.Containers {
+		container, err := planResource("Container", *containerConfig.Name, func() error {
+			_, err := blobContainersClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *containerConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, container)
+	}
+
+	queueClient, err := stack.session.CreateQueueClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create queue client from session: %w", err)
+	}
+
+	for _, queueConfig := range stack.config.Queues {
+		queue, err := planResource("Queue", *queueConfig.Name, func() error {
+			_, err := queueClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *queueConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, queue)
+	}
+
+	fileSharesClient, err := stack.session.CreateFileSharesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create file shares client from session: %w", err)
+	}
+
+	for _, fileShareConfig := range stack.config.FileShares {
+		fileShare, err := planResource("FileShare", *fileShareConfig.Name, func() error {
+			_, err := fileSharesClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *fileShareConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, fileShare)
+	}
+
+	return plan, nil
+}
+
+func (stack *BlobStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	blobStore, err := blob.CreateBlobStore(ctx, stack.config, stack.session)
+	if blobStore == nil {
+		return nil, fmt.Errorf("could not create blob storage account: %w", err)
+	}
+
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+	if blobStore.Account != nil {
+		stackInventory.AddResource(inventory.ResourceKindStorageAccount, *blobStore.Account.ID)
+	}
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create blob storage account: %w", err)
+	}
+
+	stack.setOutputs(blobStore.Account)
+
+	return stackInventory, nil
+}
+
+func (stack *BlobStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	blobStore, err := blob.GetBlobStore(ctx, stack.config, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not get blob storage account: %w", err)
+	}
+
+	stack.setOutputs(blobStore.Account)
+
+	return blobStore, nil
+}
+
+func (stack *BlobStack) Delete(ctx context.Context, options DeleteOptions) error {
+	deleteMode := blob.DeleteModeResourceGroup
+	if options.ResourceOnly {
+		deleteMode = blob.DeleteModeAccountOnly
+	}
+
+	if err := blob.DeleteBlobStore(ctx, stack.config, stack.session, deleteMode, options.Force); err != nil {
+		return fmt.Errorf("could not delete blob storage account: %w", err)
+	}
+
+	return nil
+}
+
+func (stack *BlobStack) setOutputs(account *armstorage.Account) {
+	stack.outputs = map[string]string{
+		"storageAccountId":   *account.ID,
+		"storageAccountName": *stack.config.Name,
+		"resourceGroup":      *stack.config.ResourceGroup,
+	}
+
+	if account.Properties != nil && account.Properties.PrimaryEndpoints != nil && account.Properties.PrimaryEndpoints.Blob != nil {
+		stack.outputs["blobEndpoint"] = *account.Properties.PrimaryEndpoints.Blob
+	}
+}
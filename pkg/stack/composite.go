@@ -0,0 +1,342 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-yaml/yaml"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+	resourcegroup "github.com/nukleros/azure-builder/pkg/resource-group"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypeComposite,
+		Description: "Several resource stacks provisioned together",
+		New:         NewCompositeStack,
+	})
+}
+
+// CompositeStack is a set of resource stacks, its components, provisioned
+// together. Independent components are provisioned at the same time and
+// components are torn down in the reverse of the order they depend on each
+// other in.
+type CompositeStack struct {
+	base
+	config *config.AzureCompositeConfig
+	graph  *graph
+
+	// lock guards the outputs of the components, which are set by the
+	// workers provisioning them
+	lock             sync.Mutex
+	componentOutputs map[string]map[string]string
+}
+
+func NewCompositeStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var compositeConfig config.AzureCompositeConfig
+	if err := unmarshalConfig(inventory.StackTypeComposite, configBytes, &compositeConfig, &compositeConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	// the graph is needed to delete the stack as well as to create it, so
+	// the components are checked here rather than in Validate
+	if err := compositeConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("could not validate composite config: %w", err)
+	}
+
+	for _, component := range compositeConfig.Components {
+		if *component.Type == inventory.StackTypeComposite {
+			return nil, fmt.Errorf("component %s cannot be a composite stack", *component.Name)
+		}
+		if _, err := Lookup(*component.Type); err != nil {
+			return nil, fmt.Errorf("could not find type of component %s: %w", *component.Name, err)
+		}
+	}
+
+	componentGraph, err := newGraph(compositeConfig.Components)
+	if err != nil {
+		return nil, fmt.Errorf("could not validate composite config: %w", err)
+	}
+
+	return &CompositeStack{
+		base:             base{stackType: inventory.StackTypeComposite, configBytes: configBytes, session: session},
+		config:           &compositeConfig,
+		graph:            componentGraph,
+		componentOutputs: make(map[string]map[string]string),
+	}, nil
+}
+
+// Validate checks the config of every component and that the outputs its
+// config refers to are outputs of the referenced components. Components that
+// refer to outputs are checked when they are created, once the outputs are
+// known.
+func (stack *CompositeStack) Validate() error {
+	for _, component := range stack.config.Components {
+		for _, reference := range component.GetOutputReferences() {
+			referenced, err := Lookup(*stack.component(reference.Component).Type)
+			if err != nil {
+				return err
+			}
+
+			if !slices.Contains(referenced.Outputs, reference.Output) {
+				return fmt.Errorf("component %s refers to output %s of component %s, which must be one of %s",
+					*component.Name, reference.Output, reference.Component, strings.Join(referenced.Outputs, ", "))
+			}
+		}
+
+		if component.HasOutputReferences() {
+			continue
+		}
+
+		componentStack, err := stack.newComponent(component, false)
+		if err != nil {
+			return err
+		}
+
+		if err := componentStack.Validate(); err != nil {
+			return fmt.Errorf("could not validate component %s: %w", *component.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Plan plans the components in the order they would be created in. The same
+// resource group shared by several components is only listed once. Outputs
+// are left unresolved, which is safe as the fields that identify resources
+// cannot refer to them.
+func (stack *CompositeStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	order, err := stack.graph.topologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []*PlannedResource
+	planned := make(map[string]bool)
+	for _, name := range order {
+		componentStack, err := stack.newComponent(stack.component(name), false)
+		if err != nil {
+			return nil, err
+		}
+
+		componentPlan, err := componentStack.Plan(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not plan component %s: %w", name, err)
+		}
+
+		for _, plannedResource := range componentPlan {
+			key := plannedResource.Kind + "/" + plannedResource.Name
+			if planned[key] {
+				continue
+			}
+			planned[key] = true
+			plannedResource.Component = name
+			plan = append(plan, plannedResource)
+		}
+	}
+
+	return plan, nil
+}
+
+// Create provisions the components on a bounded number of workers. The
+// resource group is created first so that components do not race to create
+// it. The inventory records the resources of every component that was
+// created, also when another component failed, so that they can be torn down.
+func (stack *CompositeStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	resourceGroup, err := resourcegroup.CreateResourceGroup(&stack.config.AzureResourceConfig, stack.session, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the resource group: %w", err)
+	}
+
+	log.Println("created resource group id:", *resourceGroup.ID)
+
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+
+	err = stack.graph.walk(ctx, stack.config.GetMaxParallel(), false, func(ctx context.Context, name string) error {
+		componentStack, err := stack.newComponent(stack.component(name), true)
+		if err != nil {
+			return err
+		}
+
+		if err := componentStack.Validate(); err != nil {
+			return fmt.Errorf("could not validate component config: %w", err)
+		}
+
+		log.Printf("creating component %s...", name)
+		componentInventory, createErr := componentStack.Create(ctx)
+
+		// resources are recorded in the order the components finish in, so
+		// tearing the inventory down in reverse respects the dependencies,
+		// and a component that failed part way records what it created
+		stack.lock.Lock()
+		defer stack.lock.Unlock()
+		if componentInventory != nil {
+			for _, resource := range componentInventory.Resources {
+				stackInventory.AddResource(resource.Kind, resource.ID)
+			}
+		}
+		if createErr != nil {
+			return createErr
+		}
+		log.Printf("created component %s", name)
+		stack.componentOutputs[name] = componentStack.Outputs()
+
+		return nil
+	})
+	stack.setOutputs()
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create composite stack %s: %w", stack.config.GetStackName(), err)
+	}
+
+	return stackInventory, nil
+}
+
+// Get returns the state of every component by component name.
+func (stack *CompositeStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	components := make(map[string]any)
+
+	err := stack.graph.walk(ctx, stack.config.GetMaxParallel(), false, func(ctx context.Context, name string) error {
+		componentStack, err := stack.newComponent(stack.component(name), true)
+		if err != nil {
+			return err
+		}
+
+		component, err := componentStack.Get(ctx, options)
+		if err != nil {
+			return err
+		}
+
+		stack.lock.Lock()
+		defer stack.lock.Unlock()
+		components[name] = component
+		stack.componentOutputs[name] = componentStack.Outputs()
+
+		return nil
+	})
+	stack.setOutputs()
+	if err != nil {
+		return nil, fmt.Errorf("could not get composite stack %s: %w", stack.config.GetStackName(), err)
+	}
+
+	return components, nil
+}
+
+// Delete deletes the components in the reverse of the order they depend on
+// each other in, each keeping the resource group, and then the resource group.
+// The components are found by their names, which cannot refer to outputs.
+func (stack *CompositeStack) Delete(ctx context.Context, options DeleteOptions) error {
+	err := stack.graph.walk(ctx, stack.config.GetMaxParallel(), true, func(ctx context.Context, name string) error {
+		componentStack, err := stack.newComponent(stack.component(name), false)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("deleting component %s...", name)
+		if err := componentStack.Delete(ctx, DeleteOptions{
+			ResourceOnly:       true,
+			Force:              options.Force,
+			DeleteSharedServer: options.DeleteSharedServer,
+		}); err != nil {
+			return err
+		}
+		log.Printf("deleted component %s", name)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete composite stack %s: %w", stack.config.GetStackName(), err)
+	}
+
+	// the last component removed from a resource group owned by the stack
+	// already deleted it
+	if options.ResourceOnly {
+		err = resourcegroup.CleanupEmptyResourceGroup(&stack.config.AzureResourceConfig, stack.session, ctx, options.Force)
+	} else {
+		err = resourcegroup.CleanupResourceGroup(&stack.config.AzureResourceConfig, stack.session, ctx, options.Force)
+	}
+	if err != nil && !util.IsNotFoundError(err) {
+		return fmt.Errorf("could not clean up resource group for composite stack %s: %w", stack.config.GetStackName(), err)
+	}
+
+	return nil
+}
+
+func (stack *CompositeStack) component(name string) *config.CompositeComponentConfig {
+	for _, component := range stack.config.Components {
+		if *component.Name == name {
+			return component
+		}
+	}
+
+	return nil
+}
+
+// newComponent builds the stack of a component. The component inherits the
+// resource group, region and stack name of the composite stack unless it sets
+// its own. With resolve set, references to the outputs of other components
+// are replaced by their values, which requires those components to be
+// created or read first.
+func (stack *CompositeStack) newComponent(component *config.CompositeComponentConfig, resolve bool) (Stack, error) {
+	componentConfig := component.Config
+	if resolve {
+		stack.lock.Lock()
+		resolvedConfig, err := component.ResolveOutputs(stack.componentOutputs)
+		stack.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		componentConfig = resolvedConfig
+	}
+
+	values := make(map[string]interface{}, len(componentConfig)+3)
+	for key, value := range componentConfig {
+		values[key] = value
+	}
+	defaults := map[string]string{
+		"ResourceGroup": *stack.config.ResourceGroup,
+		"Region":        *stack.config.Region,
+		"StackName":     stack.config.GetStackName(),
+	}
+	for key, value := range defaults {
+		if _, ok := values[key]; !ok {
+			values[key] = value
+		}
+	}
+
+	configBytes, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("could not YAML marshal config of component %s: %w", *component.Name, err)
+	}
+
+	definition, err := Lookup(*component.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	componentStack, err := definition.New(configBytes, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not load component %s: %w", *component.Name, err)
+	}
+
+	return componentStack, nil
+}
+
+// setOutputs exposes the outputs of the components as
+// <component>.<output>, the same form other components refer to them by.
+func (stack *CompositeStack) setOutputs() {
+	stack.lock.Lock()
+	defer stack.lock.Unlock()
+
+	stack.outputs = make(map[string]string)
+	for name, componentOutputs := range stack.componentOutputs {
+		for key, value := range componentOutputs {
+			stack.outputs[name+"."+key] = value
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// graph is the dependency graph of the components of a composite stack.
+type graph struct {
+	// names are the components in the order they are declared in, which
+	// breaks ties between components that are ready at the same time
+	names []string
+
+	dependencies map[string][]string
+	dependents   map[string][]string
+}
+
+func newGraph(components []*config.CompositeComponentConfig) (*graph, error) {
+	componentGraph := &graph{
+		dependencies: make(map[string][]string),
+		dependents:   make(map[string][]string),
+	}
+
+	for _, component := range components {
+		componentGraph.names = append(componentGraph.names, *component.Name)
+		for _, dependency := range component.GetDependencies() {
+			componentGraph.dependencies[*component.Name] = append(componentGraph.dependencies[*component.Name], dependency)
+			componentGraph.dependents[dependency] = append(componentGraph.dependents[dependency], *component.Name)
+		}
+	}
+
+	if _, err := componentGraph.topologicalOrder(); err != nil {
+		return nil, err
+	}
+
+	return componentGraph, nil
+}
+
+// topologicalOrder returns the components ordered so that every component
+// comes after the components it depends on.
+func (componentGraph *graph) topologicalOrder() ([]string, error) {
+	waitingOn := make(map[string]int)
+	for _, name := range componentGraph.names {
+		waitingOn[name] = len(componentGraph.dependencies[name])
+	}
+
+	var order []string
+	done := make(map[string]bool)
+	for len(order) < len(componentGraph.names) {
+		progressed := false
+		for _, name := range componentGraph.names {
+			if done[name] || waitingOn[name] > 0 {
+				continue
+			}
+			done[name] = true
+			progressed = true
+			order = append(order, name)
+			for _, dependent := range componentGraph.dependents[name] {
+				waitingOn[dependent]--
+			}
+		}
+
+		if !progressed {
+			var cycle []string
+			for _, name := range componentGraph.names {
+				if !done[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, fmt.Errorf("components %s depend on each other in a cycle", strings.Join(cycle, ", "))
+		}
+	}
+
+	return order, nil
+}
+
+// walk runs fn for every component on at most maxParallel workers. A
+// component is started once the components it depends on are done, or when
+// walking in reverse once the components that depend on it are done. After a
+// failure, or once ctx is cancelled, no more components are started. The
+// running ones are left to finish so that their resources are not left half
+// created, and all errors are returned together.
+func (componentGraph *graph) walk(
+	ctx context.Context,
+	maxParallel int,
+	reverse bool,
+	fn func(ctx context.Context, name string) error,
+) error {
+	before, after := componentGraph.dependencies, componentGraph.dependents
+	if reverse {
+		before, after = after, before
+	}
+
+	waitingOn := make(map[string]int)
+	for _, name := range componentGraph.names {
+		waitingOn[name] = len(before[name])
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+
+	// jobs are only handed out while fewer than maxParallel are running, so
+	// nothing is left queued when a component fails
+	jobs := make(chan string, maxParallel)
+	results := make(chan result)
+
+	// cancelling ctx stops new components from being started, the ones
+	// already running keep going so their resources are not half created
+	componentCtx := context.WithoutCancel(ctx)
+
+	var workers sync.WaitGroup
+	for i := 0; i < maxParallel; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for name := range jobs {
+				results <- result{name: name, err: fn(componentCtx, name)}
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		workers.Wait()
+	}()
+
+	var ready []string
+	for _, name := range componentGraph.names {
+		if waitingOn[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	var errs []error
+	running, walked := 0, 0
+	for {
+		for len(errs) == 0 && ctx.Err() == nil && len(ready) > 0 && running < maxParallel {
+			jobs <- ready[0]
+			ready = ready[1:]
+			running++
+		}
+		if running == 0 {
+			break
+		}
+
+		componentResult := <-results
+		running--
+		walked++
+
+		if componentResult.err != nil {
+			errs = append(errs, fmt.Errorf("component %s: %w", componentResult.name, componentResult.err))
+			continue
+		}
+
+		for _, name := range after[componentResult.name] {
+			waitingOn[name]--
+			if waitingOn[name] == 0 {
+				ready = append(ready, name)
+			}
+		}
+	}
+
+	if walked < len(componentGraph.names) && ctx.Err() != nil {
+		errs = append(errs, fmt.Errorf("could not start all components: %w", ctx.Err()))
+	}
+
+	return errors.Join(errs...)
+}
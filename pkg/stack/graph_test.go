@@ -0,0 +1,313 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// testGraph builds a graph from components given as a name and the names it
+// depends on.
+func testGraph(t *testing.T, components ...[]string) *graph {
+	t.Helper()
+
+	var componentConfigs []*config.CompositeComponentConfig
+	for _, component := range components {
+		componentConfigs = append(componentConfigs, &config.CompositeComponentConfig{
+			Name:      to.Ptr(component[0]),
+			DependsOn: component[1:],
+		})
+	}
+
+	componentGraph, err := newGraph(componentConfigs)
+	if err != nil {
+		t.Fatalf("could not build graph: %v", err)
+	}
+
+	return componentGraph
+}
+
+// walkEvents records the order components start and finish in.
+type walkEvents struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (events *walkEvents) add(event string) {
+	events.lock.Lock()
+	defer events.lock.Unlock()
+	events.events = append(events.events, event)
+}
+
+func (events *walkEvents) index(event string) int {
+	for i, recorded := range events.events {
+		if recorded == event {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func TestNewGraphCycle(t *testing.T) {
+	_, err := newGraph([]*config.CompositeComponentConfig{
+		{Name: to.Ptr("vault"), DependsOn: []string{"cluster"}},
+		{Name: to.Ptr("storage")},
+		{Name: to.Ptr("database"), DependsOn: []string{"vault"}},
+		{Name: to.Ptr("cluster"), DependsOn: []string{"database"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error for components that depend on each other in a cycle")
+	}
+
+	if !strings.Contains(err.Error(), "vault, database, cluster") {
+		t.Errorf("expected the components in the cycle in the error, got %q", err)
+	}
+
+	if strings.Contains(err.Error(), "storage") {
+		t.Errorf("expected only the components in the cycle in the error, got %q", err)
+	}
+}
+
+func TestNewGraphOutputReferenceCycle(t *testing.T) {
+	_, err := newGraph([]*config.CompositeComponentConfig{
+		{
+			Name:   to.Ptr("vault"),
+			Config: map[string]interface{}{"Tags": map[interface{}]interface{}{"storage": "${storage.storageAccountId}"}},
+		},
+		{
+			Name:   to.Ptr("storage"),
+			Config: map[string]interface{}{"Tags": map[interface{}]interface{}{"vault": "${vault.vaultUri}"}},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error for components that refer to each other's outputs")
+	}
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	componentGraph := testGraph(t,
+		[]string{"cluster", "database", "vault"},
+		[]string{"database", "vault"},
+		[]string{"storage"},
+		[]string{"vault"},
+	)
+
+	order, err := componentGraph.topologicalOrder()
+	if err != nil {
+		t.Fatalf("could not order components: %v", err)
+	}
+
+	expected := "storage, vault, database, cluster"
+	if strings.Join(order, ", ") != expected {
+		t.Errorf("expected order %s, got %s", expected, strings.Join(order, ", "))
+	}
+}
+
+func TestWalkMaxParallel(t *testing.T) {
+	componentGraph := testGraph(t,
+		[]string{"a"}, []string{"b"}, []string{"c"}, []string{"d"},
+		[]string{"e"}, []string{"f"}, []string{"g"}, []string{"h"},
+	)
+
+	// every component reports that it started and then waits to be released,
+	// so the test decides when a worker becomes free
+	const maxParallel = 3
+	var running, maxRunning int32
+	started := make(chan string)
+	release := make(chan struct{})
+	walked := make(chan error, 1)
+	go func() {
+		walked <- componentGraph.walk(context.Background(), maxParallel, false, func(ctx context.Context, name string) error {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				seen := atomic.LoadInt32(&maxRunning)
+				if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+					break
+				}
+			}
+
+			started <- name
+			<-release
+			atomic.AddInt32(&running, -1)
+
+			return nil
+		})
+	}()
+
+	for i := 0; i < maxParallel; i++ {
+		<-started
+	}
+
+	// one more component starts for each that is released
+	for i := maxParallel; i < 8; i++ {
+		release <- struct{}{}
+		<-started
+	}
+
+	for i := 0; i < maxParallel; i++ {
+		release <- struct{}{}
+	}
+
+	if err := <-walked; err != nil {
+		t.Fatalf("could not walk graph: %v", err)
+	}
+
+	if maxRunning != maxParallel {
+		t.Errorf("expected %d components to run at once, got %d", maxParallel, maxRunning)
+	}
+}
+
+func TestWalkStopsAfterFailure(t *testing.T) {
+	componentGraph := testGraph(t,
+		[]string{"vault"},
+		[]string{"storage"},
+		[]string{"database", "vault"},
+		[]string{"cluster", "database"},
+	)
+
+	failure := errors.New("quota exceeded")
+	events := &walkEvents{}
+	err := componentGraph.walk(context.Background(), 1, false, func(ctx context.Context, name string) error {
+		events.add(name)
+		if name == "vault" {
+			return failure
+		}
+
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the failed component, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "component vault") {
+		t.Errorf("expected the failed component in the error, got %q", err)
+	}
+
+	// with one worker the failed component is the only one that was started,
+	// the independent storage component included
+	if strings.Join(events.events, ", ") != "vault" {
+		t.Errorf("expected only vault to be started, got %s", strings.Join(events.events, ", "))
+	}
+}
+
+func TestWalkDependentsNeverStartAfterFailure(t *testing.T) {
+	componentGraph := testGraph(t,
+		[]string{"vault"},
+		[]string{"storage"},
+		[]string{"network"},
+		[]string{"database", "vault"},
+		[]string{"cluster", "database", "storage"},
+	)
+
+	failure := errors.New("quota exceeded")
+	events := &walkEvents{}
+	err := componentGraph.walk(context.Background(), 4, false, func(ctx context.Context, name string) error {
+		events.add(name)
+		if name == "vault" {
+			return failure
+		}
+
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected the error of the failed component, got %v", err)
+	}
+
+	for _, dependent := range []string{"database", "cluster"} {
+		if events.index(dependent) >= 0 {
+			t.Errorf("expected %s not to be started after vault failed", dependent)
+		}
+	}
+}
+
+func TestWalkStopsWhenCancelled(t *testing.T) {
+	componentGraph := testGraph(t,
+		[]string{"vault"},
+		[]string{"storage"},
+		[]string{"database", "vault"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := &walkEvents{}
+	err := componentGraph.walk(ctx, 1, false, func(componentCtx context.Context, name string) error {
+		events.add(name)
+		cancel()
+
+		// the running component is not interrupted
+		if componentCtx.Err() != nil {
+			t.Errorf("expected component %s to keep running after the walk was cancelled", name)
+		}
+
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the walk to be cancelled, got %v", err)
+	}
+
+	// the running component finishes, nothing is started after it
+	if strings.Join(events.events, ", ") != "vault" {
+		t.Errorf("expected only vault to be started, got %s", strings.Join(events.events, ", "))
+	}
+}
+
+func TestWalkJoinsErrors(t *testing.T) {
+	componentGraph := testGraph(t, []string{"vault"}, []string{"storage"})
+
+	err := componentGraph.walk(context.Background(), 2, false, func(ctx context.Context, name string) error {
+		return errors.New("not allowed")
+	})
+	if err == nil {
+		t.Fatal("expected the errors of the failed components")
+	}
+
+	for _, name := range []string{"vault", "storage"} {
+		if !strings.Contains(err.Error(), "component "+name) {
+			t.Errorf("expected component %s in the error, got %q", name, err)
+		}
+	}
+}
+
+func TestWalkReverse(t *testing.T) {
+	components := [][]string{
+		{"vault"},
+		{"storage"},
+		{"database", "vault"},
+		{"cache", "vault"},
+		{"cluster", "database", "storage"},
+	}
+	componentGraph := testGraph(t, components...)
+
+	events := &walkEvents{}
+	err := componentGraph.walk(context.Background(), 2, true, func(ctx context.Context, name string) error {
+		events.add("start " + name)
+		events.add("finish " + name)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not walk graph in reverse: %v", err)
+	}
+
+	for _, component := range components {
+		if events.index("finish "+component[0]) < 0 {
+			t.Errorf("expected %s to be walked", component[0])
+		}
+
+		// a component is only started once everything that depends on it is
+		// done
+		for _, dependency := range component[1:] {
+			if events.index("finish "+component[0]) > events.index("start "+dependency) {
+				t.Errorf("expected %s to finish before %s is started", component[0], dependency)
+			}
+		}
+	}
+}
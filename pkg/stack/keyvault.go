@@ -0,0 +1,120 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+	"github.com/nukleros/azure-builder/pkg/keyvault"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypeKeyVault,
+		Description: "Azure Key Vault",
+		New:         NewKeyVaultStack,
+		Outputs:     []string{"vaultId", "vaultName", "resourceGroup", "vaultUri"},
+	})
+}
+
+// KeyVaultStack is a key vault.
+type KeyVaultStack struct {
+	base
+	config *config.AzureKeyVaultConfig
+}
+
+func NewKeyVaultStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var keyVaultConfig config.AzureKeyVaultConfig
+	if err := unmarshalConfig(inventory.StackTypeKeyVault, configBytes, &keyVaultConfig, &keyVaultConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	return &KeyVaultStack{
+		base:   base{stackType: inventory.StackTypeKeyVault, configBytes: configBytes, session: session},
+		config: &keyVaultConfig,
+	}, nil
+}
+
+func (stack *KeyVaultStack) Validate() error {
+	return stack.config.Validate()
+}
+
+func (stack *KeyVaultStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	resourceGroup, err := stack.planResourceGroup(ctx, &stack.config.AzureResourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultsClient, err := stack.session.CreateKeyVaultVaultsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create key vaults client from session: %w", err)
+	}
+
+	vault, err := planResource(inventory.ResourceKindKeyVault, *stack.config.Name, func() error {
+		_, err := vaultsClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []*PlannedResource{resourceGroup, vault}, nil
+}
+
+func (stack *KeyVaultStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	keyVault, err := keyvault.CreateKeyVault(ctx, stack.config, stack.session)
+	if keyVault == nil {
+		return nil, fmt.Errorf("could not create key vault: %w", err)
+	}
+
+	// a shared vault that already existed is not part of the stack
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+	if keyVault.Vault != nil && !keyVault.VaultShared {
+		stackInventory.AddResource(inventory.ResourceKindKeyVault, *keyVault.Vault.ID)
+	}
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create key vault: %w", err)
+	}
+
+	stack.setOutputs(keyVault.Vault)
+
+	return stackInventory, nil
+}
+
+func (stack *KeyVaultStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	vault, err := keyvault.GetKeyVault(ctx, stack.config, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not get key vault: %w", err)
+	}
+
+	stack.setOutputs(vault)
+
+	return vault, nil
+}
+
+func (stack *KeyVaultStack) Delete(ctx context.Context, options DeleteOptions) error {
+	deleteMode := keyvault.DeleteModeResourceGroup
+	if options.ResourceOnly {
+		deleteMode = keyvault.DeleteModeVaultOnly
+	}
+
+	if err := keyvault.DeleteKeyVault(ctx, stack.config, stack.session, deleteMode, options.Force); err != nil {
+		return fmt.Errorf("could not delete key vault: %w", err)
+	}
+
+	return nil
+}
+
+func (stack *KeyVaultStack) setOutputs(vault *armkeyvault.Vault) {
+	stack.outputs = map[string]string{
+		"vaultId":       *vault.ID,
+		"vaultName":     *stack.config.Name,
+		"resourceGroup": *stack.config.ResourceGroup,
+	}
+
+	if vault.Properties != nil && vault.Properties.VaultURI != nil {
+		stack.outputs["vaultUri"] = *vault.Properties.VaultURI
+	}
+}
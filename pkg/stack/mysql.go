@@ -0,0 +1,156 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/mysql/armmysqlflexibleservers"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/database"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypeMySql,
+		Description: "Azure Database for MySQL flexible server",
+		New:         NewMySqlStack,
+		Outputs:     []string{"serverId", "serverName", "resourceGroup", "administratorLogin", "fqdn"},
+	})
+}
+
+// MySqlStack is a MySQL flexible server with its databases and firewall
+// rules.
+type MySqlStack struct {
+	base
+	config *config.AzureMySqlConfig
+}
+
+func NewMySqlStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var mysqlConfig config.AzureMySqlConfig
+	if err := unmarshalConfig(inventory.StackTypeMySql, configBytes, &mysqlConfig, &mysqlConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	return &MySqlStack{
+		base:   base{stackType: inventory.StackTypeMySql, configBytes: configBytes, session: session},
+		config: &mysqlConfig,
+	}, nil
+}
+
+func (stack *MySqlStack) Validate() error {
+	return stack.config.Validate()
+}
+
+func (stack *MySqlStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	resourceGroup, err := stack.planResourceGroup(ctx, &stack.config.AzureResourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	serversClient, err := stack.session.CreateMySqlServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql servers client from session: %w", err)
+	}
+
+	server, err := planResource(inventory.ResourceKindMySqlServer, *stack.config.Name, func() error {
+		_, err := serversClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := []*PlannedResource{resourceGroup, server}
+
+	databasesClient, err := stack.session.CreateMySqlDatabasesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql databases client from session: %w", err)
+	}
+
+	for _, databaseConfig := range stack.config.Databases {
+		mysqlDatabase, err := planResource("Database", *databaseConfig.Name, func() error {
+			_, err := databasesClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *databaseConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, mysqlDatabase)
+	}
+
+	firewallRulesClient, err := stack.session.CreateMySqlFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create mysql firewall rules client from session: %w", err)
+	}
+
+	for _, ruleConfig := range stack.config.FirewallRules {
+		firewallRule, err := planResource("FirewallRule", *ruleConfig.Name, func() error {
+			_, err := firewallRulesClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *ruleConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, firewallRule)
+	}
+
+	return plan, nil
+}
+
+func (stack *MySqlStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	mysqlServer, err := database.CreateMySqlServer(ctx, stack.config, stack.session)
+	if mysqlServer == nil {
+		return nil, fmt.Errorf("could not create mysql flexible server: %w", err)
+	}
+
+	// a shared server that already existed is not part of the stack
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+	if mysqlServer.Server != nil && !mysqlServer.ServerShared {
+		stackInventory.AddResource(inventory.ResourceKindMySqlServer, *mysqlServer.Server.ID)
+	}
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create mysql flexible server: %w", err)
+	}
+
+	stack.setOutputs(mysqlServer.Server)
+
+	return stackInventory, nil
+}
+
+func (stack *MySqlStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	mysqlServer, err := database.GetMySqlServer(ctx, stack.config, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not get mysql flexible server: %w", err)
+	}
+
+	stack.setOutputs(mysqlServer.Server)
+
+	return mysqlServer, nil
+}
+
+func (stack *MySqlStack) Delete(ctx context.Context, options DeleteOptions) error {
+	deleteMode := database.DeleteModeResourceGroup
+	if options.ResourceOnly {
+		deleteMode = database.DeleteModeServerOnly
+	}
+
+	if err := database.DeleteMySqlServer(ctx, stack.config, stack.session, deleteMode, options.Force); err != nil {
+		return fmt.Errorf("could not delete mysql flexible server: %w", err)
+	}
+
+	return nil
+}
+
+func (stack *MySqlStack) setOutputs(server *armmysqlflexibleservers.Server) {
+	stack.outputs = map[string]string{
+		"serverId":           *server.ID,
+		"serverName":         *stack.config.Name,
+		"resourceGroup":      *stack.config.ResourceGroup,
+		"administratorLogin": stack.config.GetAdministratorLogin(),
+	}
+
+	if server.Properties != nil && server.Properties.FullyQualifiedDomainName != nil {
+		stack.outputs["fqdn"] = *server.Properties.FullyQualifiedDomainName
+	}
+}
@@ -0,0 +1,158 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/postgresql/armpostgresqlflexibleservers/v4"
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/database"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypePostgres,
+		Description: "Azure Database for PostgreSQL flexible server",
+		New:         NewPostgresStack,
+		Outputs:     []string{"serverId", "serverName", "resourceGroup", "administratorLogin", "fqdn"},
+	})
+}
+
+// PostgresStack is a PostgreSQL flexible server with its databases and firewall
+// rules.
+type PostgresStack struct {
+	base
+	config *config.AzurePostgresConfig
+}
+
+func NewPostgresStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var postgresConfig config.AzurePostgresConfig
+	if err := unmarshalConfig(inventory.StackTypePostgres, configBytes, &postgresConfig, &postgresConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	return &PostgresStack{
+		base:   base{stackType: inventory.StackTypePostgres, configBytes: configBytes, session: session},
+		config: &postgresConfig,
+	}, nil
+}
+
+func (stack *PostgresStack) Validate() error {
+	return stack.config.Validate()
+}
+
+func (stack *PostgresStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	resourceGroup, err := stack.planResourceGroup(ctx, &stack.config.AzureResourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	serversClient, err := stack.session.CreatePostgresServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres servers client from session: %w", err)
+	}
+
+	server, err := planResource(inventory.ResourceKindPostgresServer, *stack.config.Name, func() error {
+		_, err := serversClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := []*PlannedResource{resourceGroup, server}
+
+	databasesClient, err := stack.session.CreatePostgresDatabasesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres databases client from session: %w", err)
+	}
+
+	for _, databaseConfig := range stack.config.Databases {
+		postgresDatabase, err := planResource("Database", *databaseConfig.Name, func() error {
+			_, err := databasesClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *databaseConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, postgresDatabase)
+	}
+
+	firewallRulesClient, err := stack.session.CreatePostgresFirewallRulesClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create postgres firewall rules client from session: %w", err)
+	}
+
+	for _, ruleConfig := range stack.config.FirewallRules {
+		firewallRule, err := planResource("FirewallRule", *ruleConfig.Name, func() error {
+			_, err := firewallRulesClient.Get(ctx, *stack.config.ResourceGroup, *stack.config.Name, *ruleConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, firewallRule)
+	}
+
+	return plan, nil
+}
+
+func (stack *PostgresStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	postgresServer, err := database.CreatePostgresServer(ctx, stack.config, stack.session)
+	if postgresServer == nil {
+		return nil, fmt.Errorf("could not create postgres flexible server: %w", err)
+	}
+
+	// a shared server that already existed is not part of the stack
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+	if postgresServer.Server != nil && !postgresServer.ServerShared {
+		stackInventory.AddResource(inventory.ResourceKindPostgresServer, *postgresServer.Server.ID)
+	}
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create postgres flexible server: %w", err)
+	}
+
+	stack.setOutputs(postgresServer.Server)
+
+	return stackInventory, nil
+}
+
+func (stack *PostgresStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	postgresServer, err := database.GetPostgresServer(ctx, stack.config, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not get postgres flexible server: %w", err)
+	}
+
+	stack.setOutputs(postgresServer.Server)
+
+	return postgresServer, nil
+}
+
+func (stack *PostgresStack) Delete(ctx context.Context, options DeleteOptions) error {
+	deleteMode := database.DeleteModeResourceGroup
+	if options.ResourceOnly {
+		deleteMode = database.DeleteModeServerOnly
+	}
+
+	if err := database.DeletePostgresServer(ctx, stack.config, stack.session, deleteMode, options.Force); err != nil {
+		return fmt.Errorf("could not delete postgres flexible server: %w", err)
+	}
+
+	return nil
+}
+
+func (stack *PostgresStack) setOutputs(server *armpostgresqlflexibleservers.Server) {
+	stack.outputs = map[string]string{
+		"serverId":      *server.ID,
+		"serverName":    *stack.config.Name,
+		"resourceGroup": *stack.config.ResourceGroup,
+	}
+	if stack.config.GetPasswordAuth() {
+		stack.outputs["administratorLogin"] = stack.config.GetAdministratorLogin()
+	}
+
+	if server.Properties != nil && server.Properties.FullyQualifiedDomainName != nil {
+		stack.outputs["fqdn"] = *server.Properties.FullyQualifiedDomainName
+	}
+}
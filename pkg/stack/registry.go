@@ -0,0 +1,83 @@
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+	"github.com/nukleros/azure-builder/pkg/config"
+)
+
+// Definition describes a kind of stack that can be created by name.
+type Definition struct {
+	// Name is the stack type used on the command line and in inventories.
+	Name string
+
+	// Description is shown in the list of supported stacks.
+	Description string
+
+	// New builds the stack from the raw bytes of its YAML config.
+	New func(configBytes []byte, session *config.AzureSession) (Stack, error)
+
+	// Outputs are the keys of the outputs the stack can have once created.
+	Outputs []string
+}
+
+var registry = make(map[string]*Definition)
+
+// Register makes a kind of stack available by name. Registering the same name
+// twice is a programming error and panics.
+func Register(definition *Definition) {
+	if _, ok := registry[definition.Name]; ok {
+		panic(fmt.Sprintf("stack %s is registered more than once", definition.Name))
+	}
+
+	registry[definition.Name] = definition
+}
+
+// Lookup returns the definition of the named stack.
+func Lookup(name string) (*Definition, error) {
+	definition, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported resource stack %s, must be one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	return definition, nil
+}
+
+// Names returns the names of the registered stacks in alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SupportedStacks returns the help text listing the registered stacks.
+func SupportedStacks() string {
+	var supportedStacks strings.Builder
+	supportedStacks.WriteString("\nSupported resource stacks:")
+	for _, name := range Names() {
+		fmt.Fprintf(&supportedStacks, "\n* %s (%s)", name, registry[name].Description)
+	}
+
+	return supportedStacks.String()
+}
+
+// unmarshalConfig parses the YAML config of a stack and checks the fields
+// every stack needs.
+func unmarshalConfig(stackType string, configBytes []byte, stackConfig any, resourceConfig *config.AzureResourceConfig) error {
+	if err := yaml.Unmarshal(configBytes, stackConfig); err != nil {
+		return fmt.Errorf("could not YAML unmarshal %s config: %w", stackType, err)
+	}
+
+	if err := resourceConfig.ValidateNotNull(); err != nil {
+		return fmt.Errorf("could not validate %s config: %w", stackType, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/database"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+)
+
+func init() {
+	Register(&Definition{
+		Name:        inventory.StackTypeSql,
+		Description: "Azure SQL server and databases",
+		New:         NewSqlStack,
+		Outputs:     []string{"serverId", "serverName", "resourceGroup", "fqdn"},
+	})
+}
+
+// SqlStack is an Azure SQL server with its databases and network rules.
+type SqlStack struct {
+	base
+	config *config.AzureSqlConfig
+}
+
+func NewSqlStack(configBytes []byte, session *config.AzureSession) (Stack, error) {
+	var sqlConfig config.AzureSqlConfig
+	if err := unmarshalConfig(inventory.StackTypeSql, configBytes, &sqlConfig, &sqlConfig.AzureResourceConfig); err != nil {
+		return nil, err
+	}
+
+	return &SqlStack{
+		base:   base{stackType: inventory.StackTypeSql, configBytes: configBytes, session: session},
+		config: &sqlConfig,
+	}, nil
+}
+
+func (stack *SqlStack) Validate() error {
+	return stack.config.Validate()
+}
+
+func (stack *SqlStack) Plan(ctx context.Context) ([]*PlannedResource, error) {
+	resourceGroup, err := stack.planResourceGroup(ctx, &stack.config.AzureResourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	serverName := stack.config.GetServerName()
+
+	serversClient, err := stack.session.CreateAzureSqlServersClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create servers client: %w", err)
+	}
+
+	server, err := planResource(inventory.ResourceKindSqlServer, serverName, func() error {
+		_, err := serversClient.Get(ctx, *stack.config.ResourceGroup, serverName, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	databasesClient, err := stack.session.CreateAzureSqlDatabaseClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create database client: %w", err)
+	}
+
+	plan := []*PlannedResource{resourceGroup, server}
+	for _, databaseConfig := range stack.config.GetDatabases() {
+		sqlDatabase, err := planResource(inventory.ResourceKindSqlDatabase, *databaseConfig.Name, func() error {
+			_, err := databasesClient.Get(ctx, *stack.config.ResourceGroup, serverName, *databaseConfig.Name, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, sqlDatabase)
+	}
+
+	return plan, nil
+}
+
+func (stack *SqlStack) Create(ctx context.Context) (*inventory.Inventory, error) {
+	sqlServer, err := database.CreateSqlDb(ctx, stack.config, stack.session)
+	if sqlServer == nil {
+		return nil, fmt.Errorf("could not create sql server: %w", err)
+	}
+
+	// a shared server that already existed is not part of the stack
+	stackInventory := stack.newInventory(&stack.config.AzureResourceConfig)
+	if sqlServer.Server != nil && !sqlServer.ServerShared {
+		stackInventory.AddResource(inventory.ResourceKindSqlServer, *sqlServer.Server.ID)
+	}
+	for _, sqlDatabase := range sqlServer.Databases {
+		stackInventory.AddResource(inventory.ResourceKindSqlDatabase, *sqlDatabase.ID)
+	}
+	if err != nil {
+		return stackInventory, fmt.Errorf("could not create sql server: %w", err)
+	}
+
+	stack.outputs = map[string]string{
+		"serverId":      *sqlServer.Server.ID,
+		"serverName":    stack.config.GetServerName(),
+		"resourceGroup": *stack.config.ResourceGroup,
+	}
+	if sqlServer.Server.Properties != nil && sqlServer.Server.Properties.FullyQualifiedDomainName != nil {
+		stack.outputs["fqdn"] = *sqlServer.Server.Properties.FullyQualifiedDomainName
+	}
+
+	return stackInventory, nil
+}
+
+// Get returns the connection info of the server and its databases. The
+// administrator password is only looked up when secrets are shown.
+func (stack *SqlStack) Get(ctx context.Context, options GetOptions) (any, error) {
+	var password string
+	if options.ShowSecrets && !stack.config.GetEntraOnlyAuthentication() {
+		var err error
+		if password, err = database.LookupSqlAdministratorPassword(stack.config); err != nil {
+			return nil, fmt.Errorf("could not find sql administrator password: %w", err)
+		}
+	}
+
+	connectionInfo, err := database.GetSqlConnectionInfo(ctx, stack.config, password, stack.session)
+	if err != nil {
+		return nil, fmt.Errorf("could not get sql connection info: %w", err)
+	}
+
+	stack.outputs = map[string]string{
+		"serverName":    connectionInfo.ServerName,
+		"resourceGroup": *stack.config.ResourceGroup,
+		"fqdn":          connectionInfo.FQDN,
+	}
+
+	return connectionInfo, nil
+}
+
+func (stack *SqlStack) Delete(ctx context.Context, options DeleteOptions) error {
+	deleteMode := database.DeleteModeResourceGroup
+	if options.ResourceOnly {
+		deleteMode = database.DeleteModeServerOnly
+	}
+
+	if err := database.DeleteSqlDb(ctx, stack.config, stack.session, deleteMode, options.DeleteSharedServer, options.Force); err != nil {
+		return fmt.Errorf("could not delete sql server: %w", err)
+	}
+
+	return nil
+}
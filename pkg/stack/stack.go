@@ -0,0 +1,129 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nukleros/azure-builder/pkg/config"
+	"github.com/nukleros/azure-builder/pkg/inventory"
+	"github.com/nukleros/azure-builder/pkg/util"
+)
+
+// Actions of a planned resource.
+const (
+	PlanActionCreate = "Create"
+	PlanActionUpdate = "Update"
+)
+
+// Stack is an Azure resource stack bound to its config and the session used
+// to reach Azure.
+type Stack interface {
+	// Validate checks the config of the stack.
+	Validate() error
+
+	// Plan returns the resources Create would create or update, without
+	// changing anything.
+	Plan(ctx context.Context) ([]*PlannedResource, error)
+
+	// Create provisions the stack and returns the inventory of the resources
+	// it created. A stack that fails part way returns the inventory of what
+	// it created so far along with the error.
+	Create(ctx context.Context) (*inventory.Inventory, error)
+
+	// Get returns the current state of the stack, ready to be marshalled to
+	// JSON.
+	Get(ctx context.Context, options GetOptions) (any, error)
+
+	// Delete removes the stack described by its config.
+	Delete(ctx context.Context, options DeleteOptions) error
+
+	// Outputs returns the values other stacks and users consume, such as
+	// resource IDs and endpoints. They are set by Create and Get.
+	Outputs() map[string]string
+}
+
+// PlannedResource is a resource Create would create or update. Component is
+// set for the resources of a component of a composite stack.
+type PlannedResource struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Component string `json:"component,omitempty"`
+}
+
+// GetOptions controls what Get returns.
+type GetOptions struct {
+	// ShowSecrets includes secrets such as passwords in the output of stacks
+	// that have them.
+	ShowSecrets bool
+}
+
+// DeleteOptions controls how much of a stack Delete removes.
+type DeleteOptions struct {
+	// ResourceOnly deletes only the main resource of the stack, keeping the
+	// resource group unless azure-builder created it and it is empty.
+	ResourceOnly bool
+
+	// Force deletes the resource group even if it was not created by
+	// azure-builder for this stack.
+	Force bool
+
+	// DeleteSharedServer deletes a database server even if it holds
+	// databases that are not part of the stack.
+	DeleteSharedServer bool
+}
+
+// base holds what every stack is built from.
+type base struct {
+	stackType   string
+	configBytes []byte
+	session     *config.AzureSession
+	outputs     map[string]string
+}
+
+func (stack *base) Outputs() map[string]string {
+	return stack.outputs
+}
+
+// newInventory starts the inventory of a created stack with its resource
+// group.
+func (stack *base) newInventory(resourceConfig *config.AzureResourceConfig) *inventory.Inventory {
+	stackInventory := inventory.NewInventory(stack.stackType, resourceConfig, stack.configBytes, stack.session)
+	stackInventory.AddResource(
+		inventory.ResourceKindResourceGroup,
+		inventory.ResourceGroupID(stack.session.SubscriptionID(), *resourceConfig.ResourceGroup),
+	)
+
+	return stackInventory
+}
+
+// planResourceGroup plans the resource group of the stack.
+func (stack *base) planResourceGroup(
+	ctx context.Context,
+	resourceConfig *config.AzureResourceConfig,
+) (*PlannedResource, error) {
+	resourceGroupsClient, err := stack.session.CreateAzureResourceGroupsClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not create resource groups client from session: %w", err)
+	}
+
+	return planResource(inventory.ResourceKindResourceGroup, *resourceConfig.ResourceGroup, func() error {
+		_, err := resourceGroupsClient.Get(ctx, *resourceConfig.ResourceGroup, nil)
+		return err
+	})
+}
+
+// planResource plans a resource as created when the lookup reports it does
+// not exist and as updated when it does.
+func planResource(kind string, name string, lookup func() error) (*PlannedResource, error) {
+	plannedResource := &PlannedResource{Kind: kind, Name: name, Action: PlanActionUpdate}
+
+	if err := lookup(); err != nil {
+		if !util.IsNotFoundError(err) {
+			return nil, fmt.Errorf("could not look up %s %s: %w", kind, name, err)
+		}
+		plannedResource.Action = PlanActionCreate
+	}
+
+	return plannedResource, nil
+}
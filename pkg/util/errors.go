@@ -0,0 +1,19 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// IsNotFoundError returns true when an Azure API call failed because the
+// requested resource does not exist.
+func IsNotFoundError(err error) bool {
+	var responseError *azcore.ResponseError
+	if errors.As(err, &responseError) {
+		return responseError.StatusCode == http.StatusNotFound
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// passwordCharacterClasses are the character classes of generated passwords.
+// The symbols leave out quotes, semicolons, braces and other characters that
+// need escaping in connection strings or shells.
+var passwordCharacterClasses = []string{
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"abcdefghijklmnopqrstuvwxyz",
+	"0123456789",
+	"-_.+=#%*?",
+}
+
+// GeneratePassword returns a password of the given length drawn from a
+// cryptographically secure random source. It contains at least one uppercase
+// letter, lowercase letter, digit and symbol.
+func GeneratePassword(length int) (string, error) {
+	if length < len(passwordCharacterClasses) {
+		return "", fmt.Errorf("password length must be at least %d, got %d", len(passwordCharacterClasses), length)
+	}
+
+	allCharacters := ""
+	for _, class := range passwordCharacterClasses {
+		allCharacters += class
+	}
+
+	password := make([]byte, 0, length)
+	for _, class := range passwordCharacterClasses {
+		character, err := randomCharacter(class)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, character)
+	}
+
+	for len(password) < length {
+		character, err := randomCharacter(allCharacters)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, character)
+	}
+
+	// shuffle so the guaranteed characters are not always at the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", fmt.Errorf("could not read random source: %w", err)
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+
+	return string(password), nil
+}
+
+func randomCharacter(characters string) (byte, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(len(characters))))
+	if err != nil {
+		return 0, fmt.Errorf("could not read random source: %w", err)
+	}
+
+	return characters[index.Int64()], nil
+}